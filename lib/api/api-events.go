@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/events"
+)
+
+// eventsKeepAlive is the interval between comments sent to keep the event stream open through proxies
+const eventsKeepAlive time.Duration = 30 * time.Second
+
+// getEvents streams msh lifecycle events as server-sent events.
+// Events can be filtered by minecraft server with the "server" query parameter.
+func getEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, response{Error: "streaming not supported"})
+		return
+	}
+
+	server := r.URL.Query().Get("server")
+
+	c, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "api event stream opened for %s", r.RemoteAddr)
+	defer errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "api event stream closed for %s", r.RemoteAddr)
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case e := <-c:
+			if server != "" && e.Server != server {
+				continue
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+				continue
+			}
+
+			// server-sent event: [ event type | json data ]
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"msh/lib/events"
+)
+
+func Test_getEvents(t *testing.T) {
+	server := httptest.NewServer(newRouter("secret"))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/events?server=survival", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	// events of other servers are filtered out
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		events.Publish(events.ONLINE, "creative", nil)
+		events.Publish(events.ONLINE, "survival", nil)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for _, expected := range []string{"event: online", `data: {"type":"online","server":"survival"`} {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, expected) {
+				t.Errorf("got line %q (expected %q)", line, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event not received")
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"msh/lib/progmgr"
+	"msh/lib/servctrl"
+)
+
+// reference:
+// - prometheus.io/docs/instrumenting/exposition_formats
+
+// bootBuckets are the upper bounds (seconds) of the boot duration histogram buckets
+var bootBuckets []float64 = []float64{10, 20, 30, 45, 60, 90, 120, 180, 300, 600}
+
+// statusNames are the minecraft server statuses exported as metrics
+var statusNames []string = []string{"offline", "starting", "online", "stopping", "suspended"}
+
+// getMetrics returns msh and minecraft servers metrics in prometheus text format
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(buildMetrics(servctrl.Servers())))
+}
+
+// buildMetrics returns the metrics of msh and of the specified minecraft servers in prometheus text format
+func buildMetrics(servers []*servctrl.Server) string {
+	var b strings.Builder
+
+	// metric writes the metric header
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	// ---------------- msh ---------------- //
+
+	dur, hibeDur, playSec, usageCpu, usageMem := progmgr.Usage()
+
+	metric("msh_uptime_seconds", "counter", "Seconds since msh start.")
+	fmt.Fprintf(&b, "msh_uptime_seconds %d\n", dur)
+	metric("msh_hibernation_seconds_total", "counter", "Seconds with all minecraft servers hibernating (offline or suspended).")
+	fmt.Fprintf(&b, "msh_hibernation_seconds_total %d\n", hibeDur)
+	metric("msh_play_seconds_total", "counter", "Sum of seconds played by each player.")
+	fmt.Fprintf(&b, "msh_play_seconds_total %d\n", playSec)
+	metric("msh_cpu_usage_percent", "gauge", "Average cpu usage of msh process tree in the current segment.")
+	fmt.Fprintf(&b, "msh_cpu_usage_percent %g\n", usageCpu)
+	metric("msh_memory_usage_percent", "gauge", "Average memory usage of msh process tree in the current segment.")
+	fmt.Fprintf(&b, "msh_memory_usage_percent %g\n", usageMem)
+
+	// ------------ minecraft servers ------------ //
+
+	// snapshot of the stats protected by mutex
+	type snapshot struct {
+		name          string
+		status        string
+		wakeups       int
+		kills         int
+		crashes       int
+		reclaimed     float64
+		majorErrors   int
+		majorError    bool
+		connCount     int
+		bytesToClient float64
+		bytesToServer float64
+		boots         []float64
+		statusSeconds map[string]float64
+	}
+	snaps := []snapshot{}
+	for _, srv := range servers {
+		srv.Stats.M.Lock()
+		snap := snapshot{
+			name:          escapeLabel(srv.Name),
+			status:        srv.Stats.StatusName(),
+			wakeups:       srv.Stats.Wakeups,
+			kills:         srv.Stats.Kills,
+			crashes:       srv.Stats.Crashes,
+			reclaimed:     srv.Stats.ReclaimedTotal,
+			majorErrors:   srv.Stats.MajorErrors,
+			majorError:    srv.Stats.MajorError != nil,
+			connCount:     srv.Stats.ConnCount,
+			bytesToClient: srv.Stats.BytesToClientsTotal,
+			bytesToServer: srv.Stats.BytesToServerTotal,
+			boots:         append([]float64{}, srv.Stats.BootDurations...),
+			statusSeconds: map[string]float64{},
+		}
+		for k, v := range srv.Stats.StatusSeconds {
+			snap.statusSeconds[k] = v
+		}
+		srv.Stats.M.Unlock()
+		snaps = append(snaps, snap)
+	}
+
+	metric("msh_server_status", "gauge", "Current minecraft server status (1 for the current status).")
+	for _, snap := range snaps {
+		for _, status := range statusNames {
+			v := 0
+			if status == snap.status {
+				v = 1
+			}
+			fmt.Fprintf(&b, "msh_server_status{server=\"%s\",status=\"%s\"} %d\n", snap.name, status, v)
+		}
+	}
+
+	metric("msh_server_status_seconds_total", "counter", "Seconds spent by the minecraft server in each status.")
+	for _, snap := range snaps {
+		for _, status := range statusNames {
+			fmt.Fprintf(&b, "msh_server_status_seconds_total{server=\"%s\",status=\"%s\"} %g\n", snap.name, status, snap.statusSeconds[status])
+		}
+	}
+
+	metric("msh_server_wakeups_total", "counter", "Times the minecraft server was started or resumed.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_wakeups_total{server=\"%s\"} %d\n", snap.name, snap.wakeups)
+	}
+
+	metric("msh_server_boot_duration_seconds", "histogram", "Seconds needed by the minecraft server to be online after start.")
+	for _, snap := range snaps {
+		sort.Float64s(snap.boots)
+		sum := 0.0
+		for _, d := range snap.boots {
+			sum += d
+		}
+		for _, le := range bootBuckets {
+			count := sort.Search(len(snap.boots), func(j int) bool { return snap.boots[j] > le })
+			fmt.Fprintf(&b, "msh_server_boot_duration_seconds_bucket{server=\"%s\",le=\"%g\"} %d\n", snap.name, le, count)
+		}
+		fmt.Fprintf(&b, "msh_server_boot_duration_seconds_bucket{server=\"%s\",le=\"+Inf\"} %d\n", snap.name, len(snap.boots))
+		fmt.Fprintf(&b, "msh_server_boot_duration_seconds_sum{server=\"%s\"} %g\n", snap.name, sum)
+		fmt.Fprintf(&b, "msh_server_boot_duration_seconds_count{server=\"%s\"} %d\n", snap.name, len(snap.boots))
+	}
+
+	metric("msh_server_connections", "gauge", "Clients connected to the minecraft server.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_connections{server=\"%s\"} %d\n", snap.name, snap.connCount)
+	}
+
+	metric("msh_server_bytes_total", "counter", "Bytes proxied between clients and the minecraft server.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_bytes_total{server=\"%s\",direction=\"to_clients\"} %g\n", snap.name, snap.bytesToClient)
+		fmt.Fprintf(&b, "msh_server_bytes_total{server=\"%s\",direction=\"to_server\"} %g\n", snap.name, snap.bytesToServer)
+	}
+
+	metric("msh_server_kills_total", "counter", "Times the minecraft server process was killed because it did not stop.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_kills_total{server=\"%s\"} %d\n", snap.name, snap.kills)
+	}
+
+	metric("msh_server_crashes_total", "counter", "Times the minecraft server crashed.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_crashes_total{server=\"%s\"} %d\n", snap.name, snap.crashes)
+	}
+
+	metric("msh_server_reclaimed_bytes_total", "counter", "Bytes of suspended minecraft server memory swapped out.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_reclaimed_bytes_total{server=\"%s\"} %g\n", snap.name, snap.reclaimed)
+	}
+
+	metric("msh_server_major_errors_total", "counter", "Major errors encountered by the minecraft server.")
+	for _, snap := range snaps {
+		fmt.Fprintf(&b, "msh_server_major_errors_total{server=\"%s\"} %d\n", snap.name, snap.majorErrors)
+	}
+
+	metric("msh_server_major_error", "gauge", "1 if the minecraft server has a major error (clients can't start it).")
+	for _, snap := range snaps {
+		v := 0
+		if snap.majorError {
+			v = 1
+		}
+		fmt.Fprintf(&b, "msh_server_major_error{server=\"%s\"} %d\n", snap.name, v)
+	}
+
+	return b.String()
+}
+
+// escapeLabel escapes a prometheus label value
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+func Test_buildMetrics(t *testing.T) {
+	srv := &servctrl.Server{Name: "sur\"vival", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Stats.Status = errco.SERVER_STATUS_ONLINE
+	srv.Stats.ConnCount = 2
+	srv.Stats.Wakeups = 3
+	srv.Stats.BytesToClientsTotal = 2048
+	srv.Stats.BootDurations = []float64{25, 12, 400}
+	srv.Stats.StatusSeconds["offline"] = 120
+
+	metrics := buildMetrics([]*servctrl.Server{srv})
+
+	for _, expected := range []string{
+		"# TYPE msh_hibernation_seconds_total counter\n",
+		`msh_server_status{server="sur\"vival",status="online"} 1` + "\n",
+		`msh_server_status{server="sur\"vival",status="offline"} 0` + "\n",
+		`msh_server_status_seconds_total{server="sur\"vival",status="offline"} 120` + "\n",
+		`msh_server_wakeups_total{server="sur\"vival"} 3` + "\n",
+		`msh_server_boot_duration_seconds_bucket{server="sur\"vival",le="10"} 0` + "\n",
+		`msh_server_boot_duration_seconds_bucket{server="sur\"vival",le="30"} 2` + "\n",
+		`msh_server_boot_duration_seconds_bucket{server="sur\"vival",le="+Inf"} 3` + "\n",
+		`msh_server_boot_duration_seconds_sum{server="sur\"vival"} 437` + "\n",
+		`msh_server_connections{server="sur\"vival"} 2` + "\n",
+		`msh_server_bytes_total{server="sur\"vival",direction="to_clients"} 2048` + "\n",
+		`msh_server_major_error{server="sur\"vival"} 0` + "\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("metrics do not contain: %s", expected)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/progmgr"
+	"msh/lib/servctrl"
+)
+
+// ServerStatus is the status of a minecraft server returned by the api
+type ServerStatus struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"` // offline, starting, online, stopping, suspended
+	Suspended    bool   `json:"suspended"`
+	ConnCount    int    `json:"connCount"`
+	LoadProgress string `json:"loadProgress"`
+	MajorError   string `json:"majorError,omitempty"`
+	WarmUpTime   int    `json:"warmUpTime"` // seconds since ms was warmed (-1 if not warm)
+	BootETA      int    `json:"bootEta"`    // estimated seconds to ms online status (-1 if unknown)
+}
+
+// response is the json returned by the api for actions and errors
+type response struct {
+	Ok     bool          `json:"ok"`
+	Error  string        `json:"error,omitempty"`
+	Output string        `json:"output,omitempty"`
+	Server *ServerStatus `json:"server,omitempty"`
+}
+
+// HandlerAPI serves the msh http api on ApiAddress.
+// Requests must be authenticated with "Authorization: Bearer <ApiToken>".
+// [goroutine]
+func HandlerAPI() {
+	if config.ConfigRuntime.Msh.ApiToken == "" {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_API_LISTEN, "api disabled: ApiToken must be set to enable the api")
+		return
+	}
+
+	listener, err := net.Listen("tcp", config.ConfigRuntime.Msh.ApiAddress)
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_API_LISTEN, err.Error())
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %16s ...", "listening for api requests on", listener.Addr().String())
+
+	srv := &http.Server{
+		Handler:           newRouter(config.ConfigRuntime.Msh.ApiToken),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	err = srv.Serve(listener)
+	errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_API_LISTEN, err.Error())
+}
+
+// newRouter returns the api handler (all endpoints require the token)
+func newRouter(token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/servers", getServers)
+	mux.HandleFunc("/api/status", getStatus)
+	mux.HandleFunc("/api/start", postAction(start))
+	mux.HandleFunc("/api/freeze", postAction(freeze))
+	mux.HandleFunc("/api/suspend", postAction(suspend))
+	mux.HandleFunc("/api/resume", postAction(resume))
+	mux.HandleFunc("/api/exit", postAction(exit))
+	mux.HandleFunc("/api/command", postCommand)
+	mux.HandleFunc("/api/events", getEvents)
+	mux.HandleFunc("/metrics", getMetrics)
+
+	return authorize(token, mux)
+}
+
+// authorize checks that the request contains the api token
+func authorize(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_API_AUTH, "unauthorized api request from %s: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			writeJSON(w, http.StatusUnauthorized, response{Error: "unauthorized"})
+			return
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "api request from %s: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getServers returns the status of all minecraft servers
+func getServers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+
+	statuses := []*ServerStatus{}
+	for _, srv := range servctrl.Servers() {
+		statuses = append(statuses, Status(srv))
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// getStatus returns the status of the minecraft server specified by the "server" query parameter (default server if not specified)
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+
+	srv, logMsh := targetServer(r)
+	if logMsh != nil {
+		logMsh.Log(true)
+		writeJSON(w, http.StatusNotFound, response{Error: fmt.Sprintf(logMsh.Mex, logMsh.Arg...)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Status(srv))
+}
+
+// postAction returns a handler that executes the action on the minecraft server specified by the "server" query parameter
+func postAction(action func(*servctrl.Server) *errco.MshLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+			return
+		}
+
+		srv, logMsh := targetServer(r)
+		if logMsh != nil {
+			logMsh.Log(true)
+			writeJSON(w, http.StatusNotFound, response{Error: fmt.Sprintf(logMsh.Mex, logMsh.Arg...)})
+			return
+		}
+
+		logMsh = action(srv)
+		if logMsh != nil {
+			logMsh.Log(true)
+			writeJSON(w, http.StatusConflict, response{Error: fmt.Sprintf(logMsh.Mex, logMsh.Arg...), Server: Status(srv)})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, response{Ok: true, Server: Status(srv)})
+	}
+}
+
+// postCommand executes the console command in the request body ({"command": "..."}) on the minecraft server
+// and returns the command output
+func postCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+
+	srv, logMsh := targetServer(r)
+	if logMsh != nil {
+		logMsh.Log(true)
+		writeJSON(w, http.StatusNotFound, response{Error: fmt.Sprintf(logMsh.Mex, logMsh.Arg...)})
+		return
+	}
+
+	var req struct {
+		Command string `json:"command"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || strings.TrimSpace(req.Command) == "" {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_API_REQUEST, "api command request not valid")
+		writeJSON(w, http.StatusBadRequest, response{Error: "request body must be {\"command\": \"<command>\"}"})
+		return
+	}
+
+	out, logMsh := srv.Execute(strings.TrimSpace(req.Command))
+	if logMsh != nil {
+		logMsh.Log(true)
+		writeJSON(w, http.StatusConflict, response{Error: fmt.Sprintf(logMsh.Mex, logMsh.Arg...), Server: Status(srv)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Ok: true, Output: out})
+}
+
+// Status returns the api status of the minecraft server
+func Status(srv *servctrl.Server) *ServerStatus {
+	status := &ServerStatus{
+		Name:         srv.Name,
+		Status:       srv.Stats.StatusName(),
+		Suspended:    srv.Stats.Suspended,
+		ConnCount:    srv.Stats.ConnCount,
+		LoadProgress: srv.Stats.LoadProgress,
+		WarmUpTime:   srv.WarmUpTime(),
+		BootETA:      -1,
+	}
+
+	if srv.Stats.MajorError != nil {
+		status.MajorError = fmt.Sprintf(srv.Stats.MajorError.Mex, srv.Stats.MajorError.Arg...)
+	}
+
+	if eta := srv.BootETA(); eta >= 0 {
+		status.BootETA = int(eta.Round(time.Second).Seconds())
+	}
+
+	return status
+}
+
+// targetServer returns the minecraft server specified by the "server" query parameter (default server if not specified)
+func targetServer(r *http.Request) (*servctrl.Server, *errco.MshLog) {
+	name := r.URL.Query().Get("server")
+	if name == "" {
+		return servctrl.Default, nil
+	}
+
+	srv := servctrl.ServerByName(name)
+	if srv == nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_API_REQUEST, "minecraft server %s not found", name)
+	}
+
+	return srv, nil
+}
+
+// writeJSON writes the value as json response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+}
+
+// ------------------- actions ------------------- //
+
+// start warms the minecraft server (a crash loop is reset)
+func start(srv *servctrl.Server) *errco.MshLog {
+	return srv.StartMS()
+}
+
+// freeze stops the minecraft server forcefully (after the freeze countdown).
+// [non-blocking]
+func freeze(srv *servctrl.Server) *errco.MshLog {
+	// a force freeze waits for a starting ms to be online and for the freeze countdown: don't keep the request waiting
+	go func() {
+		logMsh := srv.FreezeMSCountdown(true)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}()
+
+	return nil
+}
+
+// suspend suspends the minecraft server if it's online and empty
+func suspend(srv *servctrl.Server) *errco.MshLog {
+	if !srv.Config.Msh.SuspendAllow {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_API_REQUEST, "minecraft server suspension is not allowed (SuspendAllow is disabled)")
+	}
+	if srv.Stats.Status != errco.SERVER_STATUS_ONLINE || srv.Stats.Suspended {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server is not online")
+	}
+
+	// a soft freeze suspends ms when SuspendAllow is enabled
+	return srv.FreezeMS(false)
+}
+
+// resume resumes the suspended minecraft server
+func resume(srv *servctrl.Server) *errco.MshLog {
+	if srv.Stats.Status != errco.SERVER_STATUS_SUSPENDED && !srv.Stats.Suspended {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_SUSPENDED, "minecraft server is not suspended")
+	}
+
+	return srv.WarmMS()
+}
+
+// exit terminates msh (minecraft servers are stopped forcefully).
+// [non-blocking]
+func exit(srv *servctrl.Server) *errco.MshLog {
+	// let the response be sent before terminating msh
+	time.AfterFunc(500*time.Millisecond, progmgr.AutoTerminate)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_router(t *testing.T) {
+	router := newRouter("secret")
+
+	tests := []struct {
+		title  string
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+	}{
+		{"no token", http.MethodGet, "/api/status", "", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/api/status", "wrong", "", http.StatusUnauthorized},
+		{"status", http.MethodGet, "/api/status", "secret", "", http.StatusOK},
+		{"servers", http.MethodGet, "/api/servers", "secret", "", http.StatusOK},
+		{"unknown server", http.MethodGet, "/api/status?server=unknown", "secret", "", http.StatusNotFound},
+		{"wrong method", http.MethodGet, "/api/start", "secret", "", http.StatusMethodNotAllowed},
+		{"resume not suspended", http.MethodPost, "/api/resume", "secret", "", http.StatusConflict},
+		{"command no body", http.MethodPost, "/api/command", "secret", "", http.StatusBadRequest},
+		{"command offline", http.MethodPost, "/api/command", "secret", `{"command":"list"}`, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: got status code %d (expected %d): %s", test.title, rec.Code, test.code, rec.Body.String())
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%s: response is not valid json: %s", test.title, rec.Body.String())
+		}
+	}
+}
+
+func Test_getStatus(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+
+	newRouter("secret").ServeHTTP(rec, req)
+
+	var status ServerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("status response: %s", err.Error())
+	}
+	if status.Name != "default" || status.Status != "offline" || status.WarmUpTime != -1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
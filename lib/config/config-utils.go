@@ -3,27 +3,30 @@ package config
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/md5"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/utility"
 )
 
-// IsWhitelist checks if the parameters are in config whitelist.
-// (Currently this function accepts as arguments the client request packet and the client address)
-func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *errco.MshLog {
-	var foundMatch bool = false
-
+// IsWhitelist checks if the player or the client address are in config whitelist (allowed to wake the minecraft server).
+// (player name and uuid are the ones sent by the client in the login start packet, uuid might be empty)
+func (c *Configuration) IsWhitelist(name, uuid, clientAddress string) *errco.MshLog {
 	// check if at least one whitelist type is enabled
 	if !c.Msh.WhitelistImport && len(c.Msh.Whitelist) == 0 {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist not enabled at all")
@@ -32,24 +35,25 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 
 	// check whitelist from minecraft server config
 	if c.Msh.WhitelistImport {
-		var wl []model.MSWhitelist
-
-		// read from file whitelist.json file
-		// load minecraft server whitelist
-		// check elements of minecraft server whitelist against request packet
-		if data, err := os.ReadFile(filepath.Join(c.Server.Folder, "whitelist.json")); err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file file can't be read")
-		} else if err = json.Unmarshal(data, &wl); err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file format error")
-		} else {
+		// operators are allowed to join a whitelisted minecraft server
+		for _, f := range []string{"whitelist.json", "ops.json"} {
+			var wl []model.MSWhitelist
+
+			data, err := os.ReadFile(filepath.Join(c.Server.Folder, f))
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "%s file can't be read", f)
+				continue
+			}
+			if err = json.Unmarshal(data, &wl); err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "%s file format error", f)
+				continue
+			}
+
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching %s for: %s %s (whitelist import enabled)", f, name, uuid)
 			for _, e := range wl {
-				// nameLen contains [ lenght of name + name ] (to increase safety)
-				// omitted lenght of name:	"gekigek99 can be found both in "gekigek99" and "gekigek99-twin"
-				// with lenght of name:		"[9]gekigek99" can be found in "[9]gekigek99" and not in "[14]gekigek99-twin"
-				nameLen := append([]byte{byte(len(e.Name))}, []byte(e.Name)...)
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching byte array for: %s (whitelist import enabled)", e.Name)
-				if bytes.Contains(reqPacket, nameLen) {
-					foundMatch = true
+				if isSamePlayer(e.Name, e.UUID, name, uuid) {
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist ok!")
+					return nil
 				}
 			}
 		}
@@ -61,21 +65,11 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 
 	// check whitelist from msh config
 	if len(c.Msh.Whitelist) > 0 {
-		// check client address against msh config whitelist
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching whitelist for: %s", clientAddress)
-		if utility.SliceContain(clientAddress, c.Msh.Whitelist) {
-			foundMatch = true
-		}
-
-		// check elements of msh config whitelist against request packet
-		for _, w := range c.Msh.Whitelist {
-			// wLen contains [ lenght of w + name ] (to increase safety)
-			// follows same explanation of nameLen
-			wLen := append([]byte{byte(len(w))}, []byte(w)...)
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching byte array for: %s", w)
-			if bytes.Contains(reqPacket, wLen) {
-				foundMatch = true
-			}
+		// check client address, player name and player uuid against msh config whitelist
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching whitelist for: %s %s %s", clientAddress, name, uuid)
+		if matchWhitelist(c.Msh.Whitelist, name, uuid, clientAddress) {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist ok!")
+			return nil
 		}
 
 	} else {
@@ -83,20 +77,208 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh config whitelist not enabled")
 	}
 
-	if foundMatch {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist ok!")
+	// no match found
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "player %s (%s) is not whitelisted", name, clientAddress)
+}
+
+// IsWhitelistJoin checks if the player or the client address are in config join whitelist (allowed to join the running minecraft server).
+// If the join whitelist is empty, the player is checked against the whitelist.
+// (player name and uuid are the ones sent by the client in the login start packet, uuid might be empty)
+func (c *Configuration) IsWhitelistJoin(name, uuid, clientAddress string) *errco.MshLog {
+	if len(c.Msh.WhitelistJoin) == 0 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh config join whitelist not enabled: using whitelist")
+		return c.IsWhitelist(name, uuid, clientAddress)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching join whitelist for: %s %s %s", clientAddress, name, uuid)
+	if matchWhitelist(c.Msh.WhitelistJoin, name, uuid, clientAddress) {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "join whitelist ok!")
 		return nil
+	}
+
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "player %s (%s) is not in join whitelist", name, clientAddress)
+}
+
+// matchWhitelist checks if the player or the client address match at least one of the whitelist entries.
+//
+// Supported entries:
+// - IP address (127.0.0.1, ::1)
+// - CIDR range (10.0.0.0/8, 2001:db8::/32)
+// - reverse DNS hostname pattern (*.example.net)
+// - player name
+// - player uuid
+func matchWhitelist(whitelist []string, name, uuid, clientAddress string) bool {
+	clientIP := net.ParseIP(strings.Trim(clientAddress, "[]"))
+
+	// reverse DNS hostnames of client address are retrieved only if needed
+	var hostnames []string
+	var hostnamesLoaded bool
+
+	for _, w := range whitelist {
+		switch {
+		case strings.Contains(w, "/"):
+			_, ipNet, err := net.ParseCIDR(w)
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist entry %s is not a valid CIDR range", w)
+				continue
+			}
+			if clientIP != nil && ipNet.Contains(clientIP) {
+				return true
+			}
+
+		case strings.HasPrefix(w, "*."):
+			if !hostnamesLoaded {
+				hostnames = lookupHostnames(clientIP)
+				hostnamesLoaded = true
+			}
+			for _, h := range hostnames {
+				if strings.HasSuffix(h, strings.ToLower(w[1:])) {
+					return true
+				}
+			}
+
+		case net.ParseIP(w) != nil:
+			if net.ParseIP(w).Equal(clientIP) {
+				return true
+			}
+
+		case strings.EqualFold(w, name) || (uuid != "" && isSameUUID(w, uuid)):
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupHostnames returns the reverse DNS hostnames of ip (lowercase, without trailing dot).
+// Only hostnames that resolve back to ip are returned (forward-confirmed reverse DNS),
+// so that a client can't match a whitelist pattern by setting the PTR record of its own address.
+func lookupHostnames(ip net.IP) []string {
+	if ip == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "reverse DNS lookup of %s failed: %s", ip.String(), err.Error())
+		return nil
+	}
+
+	hostnames := []string{}
+	for _, n := range names {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, n)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.IP.Equal(ip) {
+				hostnames = append(hostnames, NormalizeHostname(n))
+				break
+			}
+		}
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "reverse DNS hostnames of %s: %v", ip.String(), hostnames)
+
+	return hostnames
+}
+
+// IsBanned checks if the player or the client address are banned from the minecraft server
+// (banned-players.json, banned-ips.json).
+// If banned, the ban reason is returned.
+func (c *Configuration) IsBanned(name, uuid, clientAddress string) (string, *errco.MshLog) {
+	// check banned players
+	var bp []model.MSBannedPlayer
+	if data, err := os.ReadFile(filepath.Join(c.Server.Folder, "banned-players.json")); err != nil {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "banned-players.json file can't be read")
+	} else if err = json.Unmarshal(data, &bp); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "banned-players.json file format error")
 	} else {
-		// no match found
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "msh config whitelist check failed")
+		for _, b := range bp {
+			// a ban is matched by name or uuid (a banned player should not be able to join by changing one of them)
+			if !strings.EqualFold(b.Name, name) && !(uuid != "" && isSameUUID(b.UUID, uuid)) {
+				continue
+			}
+			if isBanExpired(b.Expires) {
+				continue
+			}
+			return b.Reason, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_BANNED_PLAYER, "player %s is banned (reason: %s)", name, b.Reason)
+		}
+	}
+
+	// check banned ips
+	var bi []model.MSBannedIP
+	if data, err := os.ReadFile(filepath.Join(c.Server.Folder, "banned-ips.json")); err != nil {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "banned-ips.json file can't be read")
+	} else if err = json.Unmarshal(data, &bi); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "banned-ips.json file format error")
+	} else {
+		for _, b := range bi {
+			if b.IP != strings.Trim(clientAddress, "[]") || isBanExpired(b.Expires) {
+				continue
+			}
+			return b.Reason, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_BANNED_IP, "client address %s of player %s is banned (reason: %s)", clientAddress, name, b.Reason)
+		}
 	}
+
+	return "", nil
+}
+
+// isSamePlayer checks if a minecraft server list entry refers to the player.
+// If both uuids are known they must match (the offline mode uuid of the player is also accepted),
+// otherwise the player name is used.
+func isSamePlayer(entryName, entryUUID, name, uuid string) bool {
+	if !strings.EqualFold(entryName, name) {
+		return false
+	}
+
+	if entryUUID == "" || uuid == "" {
+		return true
+	}
+
+	return isSameUUID(entryUUID, uuid) || isSameUUID(entryUUID, offlineUUID(name))
+}
+
+// isSameUUID compares two uuids ignoring case and hyphens
+func isSameUUID(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, "-", ""), strings.ReplaceAll(b, "-", ""))
+}
+
+// offlineUUID returns the uuid assigned to a player by a minecraft server in offline mode
+// (uuid v3 of "OfflinePlayer:<name>")
+func offlineUUID(name string) string {
+	h := md5.Sum([]byte("OfflinePlayer:" + name))
+	h[6] = h[6]&0x0f | 0x30
+	h[8] = h[8]&0x3f | 0x80
+
+	return hex.EncodeToString(h[:])
+}
+
+// isBanExpired checks if the expiration date of a ban has passed
+func isBanExpired(expires string) bool {
+	if expires == "" || expires == "forever" {
+		return false
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05 -0700", expires)
+	if err != nil {
+		// if the expiration date is not readable consider the ban as active
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "ban expiration date format error: %s", expires)
+		return false
+	}
+
+	return time.Now().After(t)
 }
 
 // loadIcon tries to load user specified server icon (base-64 encoded and compressed).
 // The default icon is loaded by default
 func (c *Configuration) loadIcon() *errco.MshLog {
 	// set default server icon
-	ServerIcon = defaultServerIcon
+	c.ServerIcon = defaultServerIcon
+	c.ServerIconSet = false
 
 	// get the path of the user specified server icon
 	userIconPaths := []string{}
@@ -150,7 +332,8 @@ func (c *Configuration) loadIcon() *errco.MshLog {
 		}
 
 		// load user specified server icon as base64 encoded string
-		ServerIcon = base64.RawStdEncoding.EncodeToString(buff.Bytes())
+		c.ServerIcon = base64.RawStdEncoding.EncodeToString(buff.Bytes())
+		c.ServerIconSet = true
 
 		// as soon as a good image is loaded, break and return
 		break
@@ -279,3 +462,10 @@ func (c *Configuration) ParsePropertiesBool(key string) (bool, *errco.MshLog) {
 
 	return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "key (%s) not found while parsing server.properties", key)
 }
+
+// IsJSONMessage returns true if the configured message (description, title) is chat component json.
+// Messages starting with "{" or "[" that are not valid json are legacy text or MiniMessage markup.
+func IsJSONMessage(message string) bool {
+	trimmed := strings.TrimSpace(message)
+	return (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed))
+}
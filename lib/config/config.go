@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"msh/lib/errco"
@@ -21,15 +22,17 @@ import (
 var (
 	configFileName string = "msh-config.json" // configFileName is the config file name
 
-	ConfigDefault *Configuration = &Configuration{} // ConfigDefault contains parameters of config in file
-	ConfigRuntime *Configuration = &Configuration{} // ConfigRuntime contains parameters of config in runtime
+	ConfigDefault *Configuration = &Configuration{file: configFileName} // ConfigDefault contains parameters of config in file
+	ConfigRuntime *Configuration = &Configuration{}                     // ConfigRuntime contains parameters of config in runtime
+
+	// Routes contains the minecraft servers that are reached through msh
+	// depending on the server address specified by clients (loaded from config "Routes")
+	Routes []*Route
 
 	configDefaultSave bool = false // if true, the config will be saved after successful loading
 
 	JavaV string // Javav is the java version on the system. format: "java 16.0.1 2021-04-20"
 
-	ServerIcon string = defaultServerIcon // ServerIcon contains the minecraft server icon
-
 	MshHost       string = "0.0.0.0"   // MshHost		is the ip address for clients to connect to msh
 	MshPort       int                  // MshPort		is the port for clients to connect to msh
 	MshPortQuery  int                  // MshPortQuery	is the port for clients to perform stats query requests at msh
@@ -38,8 +41,30 @@ var (
 	ServPortQuery int                  // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
 )
 
+// server drivers
+const (
+	DRIVER_EXEC   string = "exec"   // ms is a child process of msh (default)
+	DRIVER_DOCKER string = "docker" // ms runs in a docker container
+)
+
 type Configuration struct {
 	model.Configuration
+
+	ServHost      string `json:"-"` // ServHost		is the ip address for msh to connect to minecraft server
+	ServPort      int    `json:"-"` // ServPort		is the port for msh to connect to minecraft server
+	ServPortQuery int    `json:"-"` // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
+	ServerIcon    string `json:"-"` // ServerIcon		contains the minecraft server icon
+	ServerIconSet bool   `json:"-"` // ServerIconSet	is true if ServerIcon is the user specified frozen icon
+
+	file string // file is the path of the config file
+}
+
+// Route is a minecraft server selected by the server address that clients specify in the handshake
+type Route struct {
+	Hostnames     []string
+	ConfigDefault *Configuration
+	ConfigRuntime *Configuration
+	Stats         *servstats.ServerStats
 }
 
 // LoadConfig loads config file into default/runtime config.
@@ -83,6 +108,15 @@ func LoadConfig() *errco.MshLog {
 		configDefaultSave = false
 	}
 
+	// ---------------- load routes ---------------- //
+
+	for _, r := range ConfigRuntime.Routes {
+		logMsh = loadRoute(r.Hostnames, r.ConfigFile)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
 	return nil
 }
 
@@ -102,12 +136,12 @@ func (c *Configuration) Save() *errco.MshLog {
 	}
 
 	// write to config file
-	err = os.WriteFile(configFileName, configData, 0644)
+	err = os.WriteFile(c.file, configData, 0644)
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONFIG_SAVE, "could not write to config file")
 	}
 
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saved default config to config file")
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saved default config to config file: %s", c.file)
 
 	return nil
 }
@@ -137,6 +171,26 @@ func (c *Configuration) BuildCommandStartServer() ([]string, *errco.MshLog) {
 
 // loadDefault loads config file to config variable
 func (c *Configuration) loadDefault() *errco.MshLog {
+	logMsh := c.loadFile()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// ------------------- setup ------------------- //
+
+	// load mshid
+	mi := MshID()
+	if c.Configuration.Msh.ID != mi {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOAD, "config msh id different from instance msh id, applying correction...")
+		c.Configuration.Msh.ID = mi
+		configDefaultSave = true
+	}
+
+	return nil
+}
+
+// loadFile loads the config file specified in c.file to config variable
+func (c *Configuration) loadFile() *errco.MshLog {
 	// get working directory
 	cwdPath, err := os.Getwd()
 	if err != nil {
@@ -144,7 +198,10 @@ func (c *Configuration) loadDefault() *errco.MshLog {
 	}
 
 	// read config file
-	configFilePath := filepath.Join(cwdPath, configFileName)
+	configFilePath := c.file
+	if !filepath.IsAbs(configFilePath) {
+		configFilePath = filepath.Join(cwdPath, configFilePath)
+	}
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "reading config file: \"%s\"", configFilePath)
 	configData, err := os.ReadFile(configFilePath)
 	if err != nil {
@@ -157,19 +214,91 @@ func (c *Configuration) loadDefault() *errco.MshLog {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
 	}
 
-	// ------------------- setup ------------------- //
+	return nil
+}
 
-	// load mshid
-	mi := MshID()
-	if c.Configuration.Msh.ID != mi {
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOAD, "config msh id different from instance msh id, applying correction...")
-		c.Configuration.Msh.ID = mi
-		configDefaultSave = true
+// loadRoute loads the config file of a routed minecraft server and appends the route to Routes.
+//
+// msh settings that are relative to the msh listener (ports, debug, ...) are ignored in the route config file.
+func loadRoute(hostnames []string, configFile string) *errco.MshLog {
+	if len(hostnames) == 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "route for config file %s has no hostnames", configFile)
+	}
+
+	r := &Route{
+		Hostnames:     []string{},
+		ConfigDefault: &Configuration{file: configFile},
+		ConfigRuntime: &Configuration{},
+		Stats:         servstats.NewStats(),
+	}
+
+	for _, h := range hostnames {
+		r.Hostnames = append(r.Hostnames, NormalizeHostname(h))
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loading route %v...", r.Hostnames)
+
+	logMsh := r.ConfigDefault.loadFile()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// initialize config to base
+	*r.ConfigRuntime = *r.ConfigDefault
+
+	// routes are not nested and msh listener settings are inherited from msh config
+	r.ConfigRuntime.Routes = nil
+	r.ConfigRuntime.Msh.Debug = ConfigRuntime.Msh.Debug
+	r.ConfigRuntime.Msh.ID = ConfigRuntime.Msh.ID
+	r.ConfigRuntime.Msh.MshPort = ConfigRuntime.Msh.MshPort
+	r.ConfigRuntime.Msh.MshPortQuery = ConfigRuntime.Msh.MshPortQuery
+	r.ConfigRuntime.Msh.EnableQuery = false // query requests can't be routed (udp packets don't specify the server address)
+
+	// the minecraft server is reached on the same host as the default one
+	r.ConfigRuntime.ServHost = ConfigRuntime.ServHost
+
+	logMsh = r.ConfigRuntime.setup(r.ConfigDefault, r.Stats)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// each minecraft server must have its own backend (servers sharing it would freeze/warm the same server)
+	if r.ConfigRuntime.ServPort == ConfigRuntime.ServPort {
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "route %v ServPort is the same as the default minecraft server one, please change one of them", r.Hostnames)
+		r.Stats.SetMajorError(logMsh)
+	}
+	for _, other := range Routes {
+		if r.ConfigRuntime.ServHost == other.ConfigRuntime.ServHost && r.ConfigRuntime.ServPort == other.ConfigRuntime.ServPort {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "route %v ServPort is the same as route %v one, please change one of them", r.Hostnames, other.Hostnames)
+			r.Stats.SetMajorError(logMsh)
+		}
 	}
 
+	if configDefaultSave {
+		logMsh := r.ConfigDefault.Save()
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		// reset config default save flag
+		configDefaultSave = false
+	}
+
+	Routes = append(Routes, r)
+
 	return nil
 }
 
+// NormalizeHostname returns the hostname in the form used to match routes.
+//
+// Data appended by modded clients and proxies to the server address (after a NULL char),
+// trailing dots and letter case are not considered.
+func NormalizeHostname(hostname string) string {
+	hostname, _, _ = strings.Cut(hostname, "\x00")
+	hostname = strings.TrimSuffix(hostname, ".")
+	return strings.ToLower(hostname)
+}
+
 // loadRuntime initializes runtime config to default config.
 // Then parses start arguments into runtime config, replaces placeholders and does the runtime config setup
 func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
@@ -237,15 +366,83 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "setting log level to: %d", c.Msh.Debug)
 	errco.DebugLvl = errco.LogLvl(c.Msh.Debug)
 
+	// check if java is installed and get java version
+	_, err = exec.LookPath("java")
+	if err != nil {
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "java not installed")
+		servstats.Stats.SetMajorError(logMsh)
+	} else if out, err := exec.Command("java", "--version").Output(); err != nil {
+		// non blocking error
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not execute 'java -version' command")
+		JavaV = "unknown"
+	} else {
+		JavaV = strings.ReplaceAll(strings.Split(string(out), "\n")[0], "\r", "")
+	}
+
+	// load msh ports
+
+	// MshHost defined in global definition
+	MshPort = c.Msh.MshPort
+	MshPortQuery = c.Msh.MshPortQuery
+
+	// minecraft server host/ports defined by msh start arguments
+	c.ServHost = ServHost
+	c.ServPort = ServPort
+	c.ServPortQuery = ServPortQuery
+
+	logMsh = c.setup(confdef, servstats.Stats)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// minecraft server ports might have been loaded from server.properties
+	ServPort = c.ServPort
+	ServPortQuery = c.ServPortQuery
+
+	return nil
+}
+
+// setup checks the minecraft server files and loads the runtime parameters of the minecraft server.
+//
+// Major errors of the minecraft server are set in stats.
+func (c *Configuration) setup(confdef *Configuration, stats *servstats.ServerStats) *errco.MshLog {
+	var logMsh *errco.MshLog
+
 	// ---------------- setup check ---------------- //
 
 	// check if server folder/executeble exist
 	serverFileFolderPath := filepath.Join(c.Server.Folder, c.Server.FileName)
-	if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
+	if c.Commands.Attach {
+		// attached ms is managed by an external supervisor (its files might not be accessible)
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server is attached: server folder/file and eula.txt are not checked")
+
+		if c.Commands.AttachStart == "" {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "Commands.AttachStart must be set when Commands.Attach is enabled")
+			stats.SetMajorError(logMsh)
+		}
+		if c.Commands.AttachStop == "" && !c.Commands.Rcon {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "Commands.AttachStop must be set when Commands.Rcon is disabled")
+			stats.SetMajorError(logMsh)
+		}
+		if c.Msh.SuspendAllow && c.Commands.AttachPid == "" && c.Commands.AttachCgroup == "" {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "suspension of attached minecraft server requires Commands.AttachPid or Commands.AttachCgroup: disabling suspension")
+			c.Msh.SuspendAllow = false
+		}
+	} else if c.Commands.Driver == DRIVER_DOCKER {
+		// ms runs in a docker container (its files might not be accessible)
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server runs in docker container: server folder/file and eula.txt are not checked")
+
+		if c.Commands.DockerContainer == "" {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "Commands.DockerContainer must be set when Commands.Driver is docker")
+			stats.SetMajorError(logMsh)
+		}
+	} else if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
 		// server folder/executeble does not exist
 
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "specified minecraft server folder/file does not exist: %s", serverFileFolderPath)
-		servstats.Stats.SetMajorError(logMsh)
+		stats.SetMajorError(logMsh)
 	} else {
 		// server folder/executeble exist
 
@@ -273,7 +470,7 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 			fmt.Print(errco.COLOR_RESET) // reset color
 			if err != nil {
 				logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "couldn't start minecraft server to generate eula.txt (%s)", err.Error())
-				servstats.Stats.SetMajorError(logMsh)
+				stats.SetMajorError(logMsh)
 			}
 			fallthrough
 
@@ -281,7 +478,7 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 			// eula.txt exists but is not set to true
 
 			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "please accept minecraft server eula.txt: %s", eulaFilePath)
-			servstats.Stats.SetMajorError(logMsh)
+			stats.SetMajorError(logMsh)
 
 		default:
 			// eula.txt exists and is set to true
@@ -290,46 +487,107 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		}
 	}
 
-	// check if java is installed and get java version
-	_, err = exec.LookPath("java")
-	if err != nil {
-		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "java not installed")
-		servstats.Stats.SetMajorError(logMsh)
-	} else if out, err := exec.Command("java", "--version").Output(); err != nil {
-		// non blocking error
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not execute 'java -version' command")
-		JavaV = "unknown"
-	} else {
-		JavaV = strings.ReplaceAll(strings.Split(string(out), "\n")[0], "\r", "")
+	// check adaptive freeze bounds
+	if c.Msh.FreezeAdaptive {
+		if c.Msh.FreezeAdaptiveMin < 0 {
+			c.Msh.FreezeAdaptiveMin = 0
+		}
+		if c.Msh.FreezeAdaptiveMax < c.Msh.FreezeAdaptiveMin {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "FreezeAdaptiveMax is lower than FreezeAdaptiveMin: setting it to %d seconds", c.Msh.FreezeAdaptiveMin)
+			c.Msh.FreezeAdaptiveMax = c.Msh.FreezeAdaptiveMin
+		}
 	}
 
-	// ---------------- setup load ----------------- //
+	// check messages that look like chat component json
+	// (invalid json messages are shown as text)
+	for name, message := range map[string]string{
+		"InfoHibernation": c.Msh.InfoHibernation,
+		"InfoStarting":    c.Msh.InfoStarting,
+		"InfoSuspended":   c.Msh.InfoSuspended,
+		"InfoBackup":      c.Msh.InfoBackup,
+		"InfoCrashLoop":   c.Msh.InfoCrashLoop,
+		"LimboTitle":      c.Msh.LimboTitle,
+		"LimboActionBar":  c.Msh.LimboActionBar,
+	} {
+		if trimmed := strings.TrimSpace(message); strings.HasPrefix(trimmed, "{") && !IsJSONMessage(trimmed) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "%s starts like chat component json but it is not valid json: showing it as text", name)
+		}
+	}
 
-	// load ports
+	// check PROXY protocol trusted proxies
+	if c.Msh.AcceptProxyProtocol && len(c.Msh.ProxyProtocolTrusted) == 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "AcceptProxyProtocol is enabled but ProxyProtocolTrusted is empty: PROXY protocol headers won't be read")
+	}
 
-	// MshHost defined in global definition
-	MshPort = c.Msh.MshPort
-	MshPortQuery = c.Msh.MshPortQuery
+	// check crash restart policy
+	if c.Msh.RestartAllow {
+		switch {
+		case c.Commands.Attach:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "attached minecraft server is restarted by its supervisor: disabling crash restart")
+			c.Msh.RestartAllow = false
+		case c.Msh.RestartMax < 0:
+			c.Msh.RestartMax = 0
+		}
+		if c.Msh.RestartBackoff < 0 {
+			c.Msh.RestartBackoff = 0
+		}
+	}
+
+	// check world backup format
+	if c.Msh.BackupAllow {
+		switch c.Msh.BackupFormat {
+		case "zip", "tar.gz", "tar.zst":
+		case "command":
+			if c.Msh.BackupCommand == "" {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "Msh.BackupCommand must be set when Msh.BackupFormat is command: disabling backup")
+				c.Msh.BackupAllow = false
+			}
+		default:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "backup format \"%s\" is not supported (zip, tar.gz, tar.zst, command): using zip", c.Msh.BackupFormat)
+			c.Msh.BackupFormat = "zip"
+		}
+	}
+
+	// check if ms process can be checkpointed with criu
+	if c.Msh.CheckpointAllow {
+		switch {
+		case runtime.GOOS != "linux":
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "checkpoint is supported only on linux: disabling checkpoint")
+			c.Msh.CheckpointAllow = false
+		case c.Commands.Attach || c.Commands.Driver == DRIVER_DOCKER:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "checkpoint is supported only for minecraft server started by msh (exec driver): disabling checkpoint")
+			c.Msh.CheckpointAllow = false
+		case c.Msh.SuspendAllow:
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension is enabled: minecraft server will be suspended instead of checkpointed")
+		}
+		if c.Msh.CheckpointKeep < 1 {
+			c.Msh.CheckpointKeep = 1
+		}
+	}
+
+	// ---------------- setup load ----------------- //
+
+	// load minecraft server ports
 
 	// ServHost	defined in global definition
-	if ServPort != 0 {
+	if c.ServPort != 0 {
 		// ServPort defined in msh start arguments
-	} else if ServPort, logMsh = c.ParsePropertiesInt("server-port"); logMsh != nil {
+	} else if c.ServPort, logMsh = c.ParsePropertiesInt("server-port"); logMsh != nil {
 		logMsh.Log(true)
-	} else if ServPort == c.Msh.MshPort {
+	} else if c.ServPort == c.Msh.MshPort {
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServPort and MshPort appear to be the same, please change one of them")
-		servstats.Stats.SetMajorError(logMsh)
+		stats.SetMajorError(logMsh)
 	}
-	if ServPortQuery != 0 {
+	if c.ServPortQuery != 0 {
 		// ServPortQuery defined in msh start arguments
-	} else if ServPortQuery, logMsh = c.ParsePropertiesInt("query.port"); logMsh != nil {
+	} else if c.ServPortQuery, logMsh = c.ParsePropertiesInt("query.port"); logMsh != nil {
 		logMsh.Log(true)
-	} else if ServPortQuery == c.Msh.MshPortQuery {
+	} else if c.ServPortQuery == c.Msh.MshPortQuery {
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServPortQuery and MshPortQuery appear to be the same, please change one of them")
-		servstats.Stats.SetMajorError(logMsh)
+		stats.SetMajorError(logMsh)
 	}
 
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPort, ServHost, ServPort)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPort, c.ServHost, c.ServPort)
 
 	// check if queries are enabled by config, start arguments or ms config
 	if !c.Msh.EnableQuery {
@@ -343,7 +601,7 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: disabled by minecraft server config")
 		c.Msh.EnableQuery = false
 	} else {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPortQuery, ServHost, ServPortQuery)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPortQuery, c.ServHost, c.ServPortQuery)
 		c.Msh.EnableQuery = true
 	}
 
@@ -0,0 +1,181 @@
+package conn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+// reference:
+// - wiki.vg/Protocol#Login_Plugin_Request
+// - wiki.vg/Protocol#Login_Success
+// - wiki.vg/Protocol#Transfer_(configuration)
+
+const (
+	// protocol versions
+	PROTOCOL_1_13   int = 393 // login plugin request introduced
+	PROTOCOL_1_20_5 int = 766 // transfer packet introduced
+	PROTOCOL_1_21_2 int = 768 // login success "strict error handling" field removed
+
+	// holdTimeout is the maximum time a client is held while waiting for ms to be online
+	holdTimeout time.Duration = 5 * time.Minute
+
+	// holdKeepAlive is the interval between the packets sent to keep a held client connected
+	holdKeepAlive time.Duration = 5 * time.Second
+)
+
+// holdLogin keeps the joining client in the login phase until the minecraft server is online.
+//
+// The client connection is kept alive with login plugin requests (that the client answers as "not understood"),
+// when ms is online the connection can be proxied forwarding the handshake and login start packets.
+func holdLogin(srv *servctrl.Server, clientConn net.Conn, hs *Handshake) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "holding client %s in login phase until minecraft server is online", hs.Username)
+
+	pr := &packetReader{conn: clientConn}
+	timeout := time.Now().Add(holdTimeout)
+
+	for messageID := 0; ; messageID++ {
+		logMsh := waitOnline(srv, timeout, holdKeepAlive)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if serverOnline(srv) {
+			return nil
+		}
+
+		// login plugin request: [ message id | channel | data ]
+		request := buildPacket(0x04, appendString(appendVarInt(nil, messageID), "msh:hold"))
+		if _, err := clientConn.Write(request); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
+		}
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, request)
+
+		// the response must be read before proxying the connection (ms would not expect it)
+		// login plugin response: [ message id | successful | data ]
+		id, _, logMsh := pr.readPacket(holdKeepAlive)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if id != 0x02 {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "unexpected packet from held client (id %d)", id)
+		}
+	}
+}
+
+// holdTransfer keeps the joining client (1.20.5+) in the configuration phase until the minecraft server is online,
+// then transfers the client back to msh so that it can join the online server.
+//
+// msh completes the login without authentication, the transferred client is authenticated by ms.
+func holdTransfer(srv *servctrl.Server, clientConn net.Conn, hs *Handshake) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "holding client %s in configuration phase until minecraft server is online", hs.Username)
+
+	logMsh := completeLogin(clientConn, hs)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// discard the packets sent by the client in configuration phase (client information, brand, keep alive responses)
+	go func() {
+		for {
+			if _, _, logMsh := (&packetReader{conn: clientConn}).readPacket(holdTimeout); logMsh != nil {
+				return
+			}
+		}
+	}()
+
+	timeout := time.Now().Add(holdTimeout)
+
+	for {
+		logMsh = waitOnline(srv, timeout, holdKeepAlive)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if serverOnline(srv) {
+			break
+		}
+
+		// keep alive (configuration): [ keep alive id ]
+		if logMsh := writePacket(clientConn, 0x04, binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixMilli()))); logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
+	// transfer (configuration): [ host | port ]
+	// the client reconnects to msh using the address it used for this connection
+	host, _, _ := strings.Cut(hs.ServerAddress, "\x00")
+	if logMsh := writePacket(clientConn, 0x0b, appendVarInt(appendString(nil, host), int(hs.ServerPort))); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s transferred to %s:%d", hs.Username, host, hs.ServerPort)
+
+	return nil
+}
+
+// completeLogin sends the login success packet to the client (1.20.5+) and waits for the login acknowledgement.
+// After this the client is in configuration phase.
+func completeLogin(clientConn net.Conn, hs *Handshake) *errco.MshLog {
+	// login success: [ uuid | username | properties count | (< 1.21.2) strict error handling ]
+	uuid, err := hex.DecodeString(strings.ReplaceAll(hs.UUID, "-", ""))
+	if err != nil || len(uuid) != 16 {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "player uuid not valid: %s", hs.UUID)
+	}
+	data := appendVarInt(appendString(uuid, hs.Username), 0)
+	if hs.ProtocolVersion < PROTOCOL_1_21_2 {
+		data = append(data, 0)
+	}
+	if logMsh := writePacket(clientConn, 0x02, data); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// login acknowledged: client switches to configuration phase
+	id, _, logMsh := (&packetReader{conn: clientConn}).readPacket(holdKeepAlive)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	if id != 0x03 {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "unexpected packet from held client (id %d)", id)
+	}
+
+	return nil
+}
+
+// serverOnline returns true if the minecraft server is online.
+// (replaced by tests to change the status while clients are held)
+var serverOnline = func(srv *servctrl.Server) bool {
+	return srv.Stats.Status == errco.SERVER_STATUS_ONLINE
+}
+
+// waitOnline waits for the minecraft server to be online for at most the specified wait time.
+// Returns an error if ms can't be online before timeout.
+func waitOnline(srv *servctrl.Server, timeout time.Time, wait time.Duration) *errco.MshLog {
+	for end := time.Now().Add(wait); time.Now().Before(end); time.Sleep(100 * time.Millisecond) {
+		switch {
+		case srv.Stats.MajorError != nil:
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "minecraft server has encountered major problems")
+		case time.Now().After(timeout):
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server did not reach online status in %s", holdTimeout.String())
+		case serverOnline(srv):
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// writePacket writes a packet to the client connection
+func writePacket(clientConn net.Conn, id int, data []byte) *errco.MshLog {
+	packet := buildPacket(id, data)
+
+	if _, err := clientConn.Write(packet); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
+	}
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, packet)
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package conn
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// fakeServerOnline replaces serverOnline with a status that can be changed while clients are held.
+// The returned function restores serverOnline.
+func fakeServerOnline(online *atomic.Bool) func() {
+	serverOnlineDefault := serverOnline
+	serverOnline = func(*servctrl.Server) bool { return online.Load() }
+	return func() { serverOnline = serverOnlineDefault }
+}
+
+func Test_holdTransfer(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Stats.Status = errco.SERVER_STATUS_STARTING
+
+	online := &atomic.Bool{}
+	defer fakeServerOnline(online)()
+
+	hs := &Handshake{
+		ProtocolVersion: 767,
+		ServerAddress:   "mc.example.net\x00FML3\x00",
+		ServerPort:      25565,
+		NextState:       STATE_LOGIN,
+		Username:        "gekigek99",
+		UUID:            "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+	}
+
+	client, msh := net.Pipe()
+	defer client.Close()
+	defer msh.Close()
+
+	done := make(chan *errco.MshLog)
+	go func() { done <- holdTransfer(srv, msh, hs) }()
+
+	pr := &packetReader{conn: client}
+
+	// login success
+	id, data, logMsh := pr.readPacket(time.Second)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	expected := append([]byte{0x06, 0x9a, 0x79, 0xf4, 0x44, 0xe9, 0x47, 0x26, 0xa5, 0xbe, 0xfc, 0xa9, 0x0e, 0x38, 0xaa, 0xf5}, appendString(nil, "gekigek99")...)
+	expected = append(expected, 0, 0)
+	if id != 0x02 || !bytes.Equal(data, expected) {
+		t.Fatalf("unexpected login success packet: id %d, data %v", id, data)
+	}
+
+	// login acknowledged
+	client.Write(buildPacket(0x03, nil))
+
+	online.Store(true)
+
+	// transfer
+	id, data, logMsh = pr.readPacket(time.Second)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if expected := appendVarInt(appendString(nil, "mc.example.net"), 25565); id != 0x0b || !bytes.Equal(data, expected) {
+		t.Fatalf("unexpected transfer packet: id %d, data %v", id, data)
+	}
+
+	if logMsh := <-done; logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+}
+
+func Test_holdLogin(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Stats.Status = errco.SERVER_STATUS_STARTING
+
+	online := &atomic.Bool{}
+	defer fakeServerOnline(online)()
+
+	client, msh := net.Pipe()
+	defer client.Close()
+	defer msh.Close()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		online.Store(true)
+	}()
+
+	if logMsh := holdLogin(srv, msh, &Handshake{ProtocolVersion: 760, Username: "gekigek99"}); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	// ms major error: client must not be held
+	online.Store(false)
+	srv.Stats.MajorError = errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "test")
+
+	if logMsh := holdLogin(srv, msh, &Handshake{ProtocolVersion: 760, Username: "gekigek99"}); logMsh == nil {
+		t.Fatalf("client should not be held when minecraft server has a major error")
+	}
+}
+
+func Test_loginRaw(t *testing.T) {
+	handshake := buildPacket(0x00, append(appendString(appendVarInt(nil, 767), "localhost"), 0x63, 0xdd, byte(STATE_TRANSFER)))
+	loginStart := buildPacket(0x00, append(appendString(nil, "gekigek99"), make([]byte, 16)...))
+
+	client, msh := net.Pipe()
+	defer client.Close()
+	defer msh.Close()
+
+	go client.Write(append(append([]byte{}, handshake...), loginStart...))
+
+	hs, logMsh := readHandshake(msh)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	raw := hs.loginRaw()
+	if raw[len(handshake)-1] != byte(STATE_LOGIN) || !bytes.Equal(raw[len(handshake):], loginStart) {
+		t.Errorf("unexpected login raw: %v", raw)
+	}
+	if hs.Raw[len(handshake)-1] != byte(STATE_TRANSFER) {
+		t.Errorf("original raw data should not be modified")
+	}
+}
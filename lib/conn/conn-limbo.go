@@ -0,0 +1,307 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/utility"
+)
+
+// reference:
+// - wiki.vg/Protocol#Configuration
+// - wiki.vg/Protocol#Login_(play)
+// - wiki.vg/Registry_Data
+
+// limbo is a minimal minecraft server implemented by msh: players wait in a void world
+// (spectator mode, no chunks are sent) while the minecraft server is starting.
+// When ms is online the players are transferred back to msh and join ms.
+
+const (
+	PROTOCOL_1_21 int = 767
+
+	// protocol versions supported by limbo (packet ids and registries are specific to these versions)
+	limboProtocolMin int = PROTOCOL_1_20_5
+	limboProtocolMax int = PROTOCOL_1_21
+
+	// default limbo messages (used when not set in config)
+	limboTitleDefault     string = "<gold>Server is starting"
+	limboActionBarDefault string = "<gray>loading {progress}, ready in {eta}"
+
+	limboKeepAlive time.Duration = 10 * time.Second // interval between play keep alive packets
+	limboUpdate    time.Duration = 1 * time.Second  // interval between action bar updates
+)
+
+// limbo packet ids (1.20.5 - 1.21.1)
+const (
+	// configuration clientbound
+	cfgFinishConfiguration int = 0x03
+	cfgRegistryData        int = 0x07
+	cfgFeatureFlags        int = 0x0c
+	cfgKnownPacks          int = 0x0e
+
+	// configuration serverbound
+	cfgAckFinishConfiguration int = 0x03
+	cfgKnownPacksResponse     int = 0x07
+
+	// play clientbound
+	playGameEvent      int = 0x22
+	playKeepAlive      int = 0x26
+	playLogin          int = 0x2b
+	playSyncPosition   int = 0x40
+	playActionBar      int = 0x4c
+	playTitleText      int = 0x65
+	playTitleAnimation int = 0x66
+	playTransfer       int = 0x73
+)
+
+// limboKnownPackVersions are the versions of the "minecraft:core" data pack known by the clients of each protocol
+var limboKnownPackVersions map[int][]string = map[int][]string{
+	PROTOCOL_1_20_5: {"1.20.5", "1.20.6"},
+	PROTOCOL_1_21:   {"1.21", "1.21.1"},
+}
+
+// limboRegistries returns the registry entries that are sent to the client.
+// Entry data is not sent: the client loads it from its "minecraft:core" data pack.
+// Registries referenced by client code (biomes, dimension types, damage types) must contain the vanilla entries.
+func limboRegistries(protocol int) map[string][]string {
+	damageTypes := []string{
+		"arrow", "bad_respawn_point", "cactus", "cramming", "dragon_breath", "drown", "dry_out", "explosion",
+		"fall", "falling_anvil", "falling_block", "falling_stalactite", "fireball", "fireworks", "fly_into_wall",
+		"freeze", "generic", "generic_kill", "hot_floor", "in_fire", "in_wall", "indirect_magic", "lava",
+		"lightning_bolt", "magic", "mob_attack", "mob_attack_no_aggro", "mob_projectile", "on_fire", "out_of_world",
+		"outside_border", "player_attack", "player_explosion", "sonic_boom", "spit", "stalagmite", "starve", "sting",
+		"sweet_berry_bush", "thorns", "thrown", "trident", "unattributed_fireball", "wind_charge", "wither", "wither_skull",
+	}
+
+	registries := map[string][]string{
+		"minecraft:dimension_type":   {"overworld"},
+		"minecraft:worldgen/biome":   {"plains", "the_void"},
+		"minecraft:chat_type":        {"chat", "emote_command", "msg_command_incoming", "msg_command_outgoing", "say_command", "team_msg_command_incoming", "team_msg_command_outgoing"},
+		"minecraft:damage_type":      damageTypes,
+		"minecraft:wolf_variant":     {"pale"},
+		"minecraft:trim_pattern":     {},
+		"minecraft:trim_material":    {},
+		"minecraft:banner_pattern":   {},
+		"minecraft:painting_variant": {},
+		"minecraft:enchantment":      {},
+		"minecraft:jukebox_song":     {},
+	}
+
+	if protocol >= PROTOCOL_1_21 {
+		registries["minecraft:damage_type"] = append(damageTypes, "campfire")
+	} else {
+		// registries introduced in 1.21
+		delete(registries, "minecraft:enchantment")
+		delete(registries, "minecraft:jukebox_song")
+	}
+
+	return registries
+}
+
+// limboSupported returns true if limbo is enabled and the client protocol version can join it.
+// The configured protocol range is restricted to the protocol versions implemented by limbo (0 means no limit).
+func limboSupported(srv *servctrl.Server, protocol int) bool {
+	switch {
+	case !srv.Config.Msh.Limbo:
+		return false
+	case protocol < limboProtocolMin || protocol > limboProtocolMax:
+		return false
+	case protocol < srv.Config.Msh.LimboProtocolMin:
+		return false
+	case srv.Config.Msh.LimboProtocolMax != 0 && protocol > srv.Config.Msh.LimboProtocolMax:
+		return false
+	default:
+		return true
+	}
+}
+
+// enterLimbo makes the joining client join the msh limbo and keeps it there until the minecraft server is online,
+// then transfers the client back to msh so that it can join the online server.
+//
+// msh completes the login without authentication, the transferred client is authenticated by ms.
+func enterLimbo(srv *servctrl.Server, clientConn net.Conn, hs *Handshake) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s joined limbo while minecraft server is starting", hs.Username)
+
+	logMsh := completeLogin(clientConn, hs)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = limboConfiguration(clientConn, hs)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = limboJoin(clientConn)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// discard the packets sent by the client in play phase (movement, keep alive responses)
+	go func() {
+		for {
+			if _, _, logMsh := (&packetReader{conn: clientConn}).readPacket(holdTimeout); logMsh != nil {
+				return
+			}
+		}
+	}()
+
+	// title shown when entering limbo
+	if logMsh = writePacket(clientConn, playTitleAnimation, binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 10), 70), 20)); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	if logMsh = writeText(srv, clientConn, playTitleText, utility.FirstNon("", srv.Config.Msh.LimboTitle, limboTitleDefault)); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	timeout := time.Now().Add(holdTimeout)
+	lastKeepAlive := time.Now()
+
+	for {
+		logMsh = waitOnline(srv, timeout, limboUpdate)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if serverOnline(srv) {
+			break
+		}
+
+		// action bar showing the start progress
+		if logMsh = writeText(srv, clientConn, playActionBar, utility.FirstNon("", srv.Config.Msh.LimboActionBar, limboActionBarDefault)); logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		// keep alive (play): [ keep alive id ]
+		if time.Since(lastKeepAlive) >= limboKeepAlive {
+			if logMsh = writePacket(clientConn, playKeepAlive, binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixMilli()))); logMsh != nil {
+				return logMsh.AddTrace()
+			}
+			lastKeepAlive = time.Now()
+		}
+	}
+
+	// transfer (play): [ host | port ]
+	// the client reconnects to msh using the address it used for this connection
+	host, _, _ := strings.Cut(hs.ServerAddress, "\x00")
+	if logMsh = writePacket(clientConn, playTransfer, appendVarInt(appendString(nil, host), int(hs.ServerPort))); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s transferred from limbo to %s:%d", hs.Username, host, hs.ServerPort)
+
+	return nil
+}
+
+// limboConfiguration sends the data needed by the client to join limbo (known packs, feature flags, registries)
+// and finishes the configuration phase.
+func limboConfiguration(clientConn net.Conn, hs *Handshake) *errco.MshLog {
+	pr := &packetReader{conn: clientConn}
+
+	// known packs: [ count | (namespace | id | version) ]
+	data := appendVarInt(nil, len(limboKnownPackVersions[hs.ProtocolVersion]))
+	for _, version := range limboKnownPackVersions[hs.ProtocolVersion] {
+		data = appendString(appendString(appendString(data, "minecraft"), "core"), version)
+	}
+	if logMsh := writePacket(clientConn, cfgKnownPacks, data); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// wait for the known packs accepted by the client (client information and brand are ignored)
+	for {
+		id, data, logMsh := pr.readPacket(holdKeepAlive)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if id != cfgKnownPacksResponse {
+			continue
+		}
+		if count, err := readVarInt(bytes.NewReader(data)); err != nil || count == 0 {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client %s does not know the minecraft:core data pack", hs.Username)
+		}
+		break
+	}
+
+	// feature flags: [ count | flags ]
+	if logMsh := writePacket(clientConn, cfgFeatureFlags, appendString(appendVarInt(nil, 1), "minecraft:vanilla")); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// registry data: [ registry id | entry count | (entry id | has data) ]
+	for registry, entries := range limboRegistries(hs.ProtocolVersion) {
+		data := appendVarInt(appendString(nil, registry), len(entries))
+		for _, e := range entries {
+			data = append(appendString(data, "minecraft:"+e), 0)
+		}
+		if logMsh := writePacket(clientConn, cfgRegistryData, data); logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
+	// finish configuration
+	if logMsh := writePacket(clientConn, cfgFinishConfiguration, nil); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	for {
+		id, _, logMsh := pr.readPacket(holdKeepAlive)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if id == cfgAckFinishConfiguration {
+			return nil
+		}
+	}
+}
+
+// limboJoin makes the client (that is in play phase) spawn in the limbo void world
+func limboJoin(clientConn net.Conn) *errco.MshLog {
+	// login (play): [ entity id | hardcore | dimensions | max players | view distance | simulation distance |
+	// reduced debug info | respawn screen | limited crafting | dimension type | dimension name | hashed seed |
+	// game mode | previous game mode | debug | flat | has death location | portal cooldown | secure chat ]
+	data := binary.BigEndian.AppendUint32(nil, 1)
+	data = append(data, 0)
+	data = appendString(appendVarInt(data, 1), "minecraft:overworld")
+	data = appendVarInt(appendVarInt(appendVarInt(data, 1), 2), 2)
+	data = append(data, 0, 0, 0)
+	data = appendString(appendVarInt(data, 0), "minecraft:overworld")
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = append(data, 3, 0xff, 0, 1, 0) // spectator: the loading screen is closed without sending chunks
+	data = append(appendVarInt(data, 0), 0)
+	if logMsh := writePacket(clientConn, playLogin, data); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// game event "start waiting for level chunks": [ event | value ]
+	if logMsh := writePacket(clientConn, playGameEvent, append([]byte{13}, 0, 0, 0, 0)); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// synchronize player position: [ x | y | z | yaw | pitch | flags | teleport id ]
+	data = binary.BigEndian.AppendUint64(nil, math.Float64bits(0))
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(100))
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(0))
+	data = binary.BigEndian.AppendUint32(data, math.Float32bits(0))
+	data = binary.BigEndian.AppendUint32(data, math.Float32bits(0))
+	data = appendVarInt(append(data, 0), 1)
+	if logMsh := writePacket(clientConn, playSyncPosition, data); logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// writeText writes a packet containing only a text component (title, action bar).
+// message can contain placeholders and can be formatted as chat component json, MiniMessage markup or legacy text.
+func writeText(srv *servctrl.Server, clientConn net.Conn, id int, message string) *errco.MshLog {
+	data, logMsh := appendNBTText(nil, formatMessage(srv, message))
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return writePacket(clientConn, id, data)
+}
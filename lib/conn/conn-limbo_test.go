@@ -0,0 +1,159 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+func Test_enterLimbo(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Stats.Status = errco.SERVER_STATUS_STARTING
+
+	online := &atomic.Bool{}
+	defer fakeServerOnline(online)()
+
+	hs := &Handshake{
+		ProtocolVersion: PROTOCOL_1_21,
+		ServerAddress:   "mc.example.net",
+		ServerPort:      25565,
+		NextState:       STATE_LOGIN,
+		Username:        "gekigek99",
+		UUID:            "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+	}
+
+	client, msh := net.Pipe()
+	defer client.Close()
+	defer msh.Close()
+
+	done := make(chan *errco.MshLog)
+	go func() { done <- enterLimbo(srv, msh, hs) }()
+
+	pr := &packetReader{conn: client}
+
+	// expect reads the next packet from msh and checks its id
+	expect := func(phase string, expectedID int) []byte {
+		id, data, logMsh := pr.readPacket(time.Second)
+		if logMsh != nil {
+			t.Fatalf("%s: "+logMsh.Mex, append([]interface{}{phase}, logMsh.Arg...)...)
+		}
+		if id != expectedID {
+			t.Fatalf("%s: unexpected packet id %d (expected %d)", phase, id, expectedID)
+		}
+		return data
+	}
+
+	// login
+	expect("login success", 0x02)
+	client.Write(buildPacket(0x03, nil))
+
+	// configuration
+	expect("known packs", cfgKnownPacks)
+	client.Write(buildPacket(0x00, []byte{0x05, 'e', 'n', '_', 'u', 's'})) // client information (ignored)
+	client.Write(buildPacket(cfgKnownPacksResponse, appendString(appendString(appendString(appendVarInt(nil, 1), "minecraft"), "core"), "1.21")))
+	expect("feature flags", cfgFeatureFlags)
+	for range limboRegistries(hs.ProtocolVersion) {
+		expect("registry data", cfgRegistryData)
+	}
+	expect("finish configuration", cfgFinishConfiguration)
+	client.Write(buildPacket(cfgAckFinishConfiguration, nil))
+
+	// play
+	expect("login (play)", playLogin)
+	expect("game event", playGameEvent)
+	expect("synchronize player position", playSyncPosition)
+	expect("title animation", playTitleAnimation)
+	expect("title", playTitleText)
+
+	online.Store(true)
+
+	for {
+		id, data, logMsh := pr.readPacket(2 * time.Second)
+		if logMsh != nil {
+			t.Fatalf("transfer: "+logMsh.Mex, logMsh.Arg...)
+		}
+		if id == playActionBar {
+			continue
+		}
+		if expected := appendVarInt(appendString(nil, "mc.example.net"), 25565); id != playTransfer || !bytes.Equal(data, expected) {
+			t.Fatalf("unexpected transfer packet: id %d, data %v", id, data)
+		}
+		break
+	}
+
+	if logMsh := <-done; logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+}
+
+func Test_limboSupported(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+
+	tests := []struct {
+		limbo    bool
+		min, max int
+		protocol int
+		expected bool
+	}{
+		{false, 0, 0, 767, false},
+		{true, 0, 0, 767, true},
+		{true, 0, 0, 765, false}, // not implemented by limbo
+		{true, 0, 0, 768, false}, // not implemented by limbo
+		{true, 767, 0, 766, false},
+		{true, 766, 766, 767, false},
+		{true, 766, 767, 766, true},
+	}
+
+	for _, test := range tests {
+		srv.Config.Msh.Limbo = test.limbo
+		srv.Config.Msh.LimboProtocolMin = test.min
+		srv.Config.Msh.LimboProtocolMax = test.max
+
+		if r := limboSupported(srv, test.protocol); r != test.expected {
+			t.Errorf("limbo %t, range %d-%d, protocol %d: got %t (expected %t)", test.limbo, test.min, test.max, test.protocol, r, test.expected)
+		}
+	}
+}
+
+func Test_appendNBTText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []byte
+	}{
+		{
+			`"hi"`,
+			[]byte{tagString, 0, 2, 'h', 'i'},
+		},
+		{
+			`{"bold":true,"text":"a"}`,
+			[]byte{tagCompound, tagByte, 0, 4, 'b', 'o', 'l', 'd', 1, tagString, 0, 4, 't', 'e', 'x', 't', 0, 1, 'a', 0},
+		},
+		{
+			// mixed list elements are converted to compounds
+			`{"extra":["a",{"text":"b"}]}`,
+			[]byte{tagCompound, tagList, 0, 5, 'e', 'x', 't', 'r', 'a', tagCompound, 0, 0, 0, 2,
+				tagString, 0, 4, 't', 'e', 'x', 't', 0, 1, 'a', 0,
+				tagString, 0, 4, 't', 'e', 'x', 't', 0, 1, 'b', 0,
+				0},
+		},
+	}
+
+	for _, test := range tests {
+		data, logMsh := appendNBTText(nil, json.RawMessage(test.text))
+		if logMsh != nil {
+			t.Errorf("%s: "+logMsh.Mex, append([]interface{}{test.text}, logMsh.Arg...)...)
+			continue
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("%s: got %v (expected %v)", test.text, data, test.expected)
+		}
+	}
+}
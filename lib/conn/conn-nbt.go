@@ -0,0 +1,122 @@
+package conn
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - wiki.vg/NBT
+// - wiki.vg/Text_formatting#Text_components (1.20.3+ text components are sent as network NBT)
+
+// nbt tag types
+const (
+	tagByte     byte = 1
+	tagInt      byte = 3
+	tagDouble   byte = 6
+	tagString   byte = 8
+	tagList     byte = 9
+	tagCompound byte = 10
+)
+
+// appendNBTText appends the chat component json as a network NBT tag (unnamed root tag)
+func appendNBTText(data []byte, text json.RawMessage) ([]byte, *errco.MshLog) {
+	var v interface{}
+	if err := json.Unmarshal(text, &v); err != nil {
+		return data, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	// a list is not a valid root text component
+	if l, ok := v.([]interface{}); ok {
+		v = map[string]interface{}{"text": "", "extra": l}
+	}
+
+	return appendNBTPayload(append(data, nbtType(v)), v), nil
+}
+
+// nbtType returns the nbt tag type used to encode the json value
+func nbtType(v interface{}) byte {
+	switch v := v.(type) {
+	case bool:
+		return tagByte
+	case float64:
+		if v == float64(int32(v)) {
+			return tagInt
+		}
+		return tagDouble
+	case []interface{}:
+		return tagList
+	case map[string]interface{}:
+		return tagCompound
+	default:
+		return tagString
+	}
+}
+
+// appendNBTPayload appends the json value encoded as nbt tag payload
+func appendNBTPayload(data []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return append(data, 1)
+		}
+		return append(data, 0)
+
+	case float64:
+		if nbtType(v) == tagInt {
+			return binary.BigEndian.AppendUint32(data, uint32(int32(v)))
+		}
+		return binary.BigEndian.AppendUint64(data, math.Float64bits(v))
+
+	case string:
+		// strings are modified UTF-8, equal to UTF-8 for the characters used in messages
+		data = binary.BigEndian.AppendUint16(data, uint16(len(v)))
+		return append(data, v...)
+
+	case []interface{}:
+		// list elements must have the same type: mixed text components are converted to compounds
+		elemType := tagCompound
+		if len(v) > 0 {
+			elemType = nbtType(v[0])
+		}
+		for _, e := range v {
+			if nbtType(e) != elemType {
+				elemType = tagCompound
+				for i, e := range v {
+					if s, ok := e.(string); ok {
+						v[i] = map[string]interface{}{"text": s}
+					}
+				}
+				break
+			}
+		}
+		data = append(data, elemType)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(v)))
+		for _, e := range v {
+			data = appendNBTPayload(data, e)
+		}
+		return data
+
+	case map[string]interface{}:
+		// sorted keys for a deterministic encoding
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			data = append(data, nbtType(v[k]))
+			data = appendNBTPayload(data, k)
+			data = appendNBTPayload(data, v[k])
+		}
+		return append(data, 0) // end tag
+
+	default:
+		return appendNBTPayload(data, "")
+	}
+}
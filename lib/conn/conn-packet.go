@@ -0,0 +1,347 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - wiki.vg/Protocol#Handshake
+// - wiki.vg/Protocol#Login_Start
+// - wiki.vg/Protocol_version_numbers
+
+const (
+	// maxPacketLen is the maximum length of a packet that msh reads from a client before the connection is proxied.
+	// (the longest packet msh reads is the handshake forwarded by BungeeCord in ip forward mode, see maxServerAddressLen)
+	maxPacketLen int = 1 << 17
+
+	// maxServerAddressLen is the maximum length of the handshake server address (as accepted by spigot).
+	// BungeeCord in ip forward mode appends "\x00ip\x00uuid\x00properties" to the server address.
+	maxServerAddressLen int = 32767
+
+	// handshake next states
+	STATE_STATUS   int = 1
+	STATE_LOGIN    int = 2
+	STATE_TRANSFER int = 3
+)
+
+// Handshake contains the data sent by a client to msh before the connection is proxied to the minecraft server
+type Handshake struct {
+	ProtocolVersion int    // client protocol version
+	ServerAddress   string // server address typed by the player (modded clients and proxies might append data after a NULL char)
+	ServerPort      uint16 // server port typed by the player
+	NextState       int    // STATE_STATUS, STATE_LOGIN or STATE_TRANSFER
+	Username        string // player name (login/transfer requests only)
+	UUID            string // player uuid in hyphenated form (login/transfer requests only, empty if not sent by the client)
+	Raw             []byte // bytes received from client (must be forwarded to the minecraft server)
+
+	handshakeLen int // length of the handshake packet in Raw
+}
+
+// packetReader reads minecraft protocol packets from a client connection.
+//
+// It never reads more bytes than the ones belonging to the packets it returns,
+// so that the remaining data can be read from the connection by other functions.
+type packetReader struct {
+	conn net.Conn
+	raw  bytes.Buffer // bytes read from the connection
+}
+
+// readPacket reads a full packet and returns its id and data.
+// The client must send the packet before the timeout expires.
+func (pr *packetReader) readPacket(timeout time.Duration) (int, []byte, *errco.MshLog) {
+	// set deadline to avoid hanging when client is not sending a packet that msh expects
+	pr.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer pr.conn.SetReadDeadline(time.Time{})
+
+	// packet: [ length | packet id | data ]
+	length, err := readVarInt(pr)
+	if err != nil {
+		return -1, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	}
+	if length <= 0 || length > maxPacketLen {
+		return -1, nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "unexpected packet length (%d)", length)
+	}
+
+	packet := make([]byte, length)
+	_, err = io.ReadFull(pr, packet)
+	if err != nil {
+		return -1, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sclient --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, packet)
+
+	r := bytes.NewReader(packet)
+	id, err := readVarInt(r)
+	if err != nil {
+		return -1, nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "packet id: %s", err.Error())
+	}
+
+	return id, packet[len(packet)-r.Len():], nil
+}
+
+// Read reads from the client connection and keeps track of the bytes read
+func (pr *packetReader) Read(p []byte) (int, error) {
+	n, err := pr.conn.Read(p)
+	pr.raw.Write(p[:n])
+	return n, err
+}
+
+// ReadByte reads a single byte from the client connection
+func (pr *packetReader) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	_, err := io.ReadFull(pr, b)
+	return b[0], err
+}
+
+// readHandshake reads the handshake packet and, for login/transfer requests, the login start packet.
+func readHandshake(clientConn net.Conn) (*Handshake, *errco.MshLog) {
+	pr := &packetReader{conn: clientConn}
+	hs := &Handshake{}
+
+	// ------------ handshake packet ------------- //
+
+	id, data, logMsh := pr.readPacket(1 * time.Second)
+	if logMsh != nil {
+		hs.Raw = pr.raw.Bytes()
+		return hs, logMsh.AddTrace()
+	}
+	if id != 0x00 {
+		hs.Raw = pr.raw.Bytes()
+		return hs, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "unexpected handshake packet id (%d)", id)
+	}
+
+	logMsh = hs.decodeHandshake(data)
+	if logMsh != nil {
+		hs.Raw = pr.raw.Bytes()
+		return hs, logMsh.AddTrace()
+	}
+	hs.handshakeLen = pr.raw.Len()
+
+	// ----------- login start packet ------------ //
+
+	if hs.NextState == STATE_LOGIN || hs.NextState == STATE_TRANSFER {
+		id, data, logMsh = pr.readPacket(1 * time.Second)
+		if logMsh != nil {
+			hs.Raw = pr.raw.Bytes()
+			return hs, logMsh.AddTrace()
+		}
+		if id != 0x00 {
+			hs.Raw = pr.raw.Bytes()
+			return hs, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "unexpected login start packet id (%d)", id)
+		}
+
+		logMsh = hs.decodeLoginStart(data)
+		if logMsh != nil {
+			hs.Raw = pr.raw.Bytes()
+			return hs, logMsh.AddTrace()
+		}
+	}
+
+	hs.Raw = pr.raw.Bytes()
+
+	return hs, nil
+}
+
+// loginRaw returns the bytes received from client with the handshake next state set to login.
+// Used to forward a client transferred by msh to a minecraft server that does not accept transfers.
+func (hs *Handshake) loginRaw() []byte {
+	if hs.NextState != STATE_TRANSFER || hs.handshakeLen == 0 {
+		return hs.Raw
+	}
+
+	// next state is the last field of the handshake packet (single byte varint)
+	raw := append([]byte{}, hs.Raw...)
+	raw[hs.handshakeLen-1] = byte(STATE_LOGIN)
+
+	return raw
+}
+
+// decodeHandshake decodes the handshake packet data into hs
+func (hs *Handshake) decodeHandshake(data []byte) *errco.MshLog {
+	// handshake data: [ protocol version | server address | server port | next state ]
+	r := bytes.NewReader(data)
+
+	protocolVersion, err := readVarInt(r)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "protocol version: %s", err.Error())
+	}
+	serverAddress, err := readString(r, maxServerAddressLen)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "server address: %s", err.Error())
+	}
+	var serverPort uint16
+	err = binary.Read(r, binary.BigEndian, &serverPort)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "server port: %s", err.Error())
+	}
+	nextState, err := readVarInt(r)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "next state: %s", err.Error())
+	}
+
+	if nextState != STATE_STATUS && nextState != STATE_LOGIN && nextState != STATE_TRANSFER {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "unexpected next state (%d)", nextState)
+	}
+
+	hs.ProtocolVersion = protocolVersion
+	hs.ServerAddress = serverAddress
+	hs.ServerPort = serverPort
+	hs.NextState = nextState
+
+	return nil
+}
+
+// decodeLoginStart decodes the login start packet data into hs.
+// Login start packet format depends on the client protocol version.
+func (hs *Handshake) decodeLoginStart(data []byte) *errco.MshLog {
+	r := bytes.NewReader(data)
+
+	name, err := readString(r, 16)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "player name: %s", err.Error())
+	}
+	hs.Username = name
+
+	switch {
+	case hs.ProtocolVersion < 759:
+		// < 1.19: [ name ]
+		return nil
+
+	case hs.ProtocolVersion < 761:
+		// 1.19 - 1.19.2: [ name | has sig data | (timestamp | public key | signature) | (1.19.1+) has uuid | (uuid) ]
+		hasSigData, err := r.ReadByte()
+		if err != nil {
+			return nil
+		}
+		if hasSigData == 1 {
+			// skip timestamp, public key, signature
+			if _, err := r.Seek(8, io.SeekCurrent); err != nil {
+				return nil
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := readBytes(r, maxPacketLen); err != nil {
+					return nil
+				}
+			}
+		}
+		if hs.ProtocolVersion == 759 {
+			return nil
+		}
+		fallthrough
+
+	case hs.ProtocolVersion < 764:
+		// 1.19.3 - 1.20.1: [ name | has uuid | (uuid) ]
+		hasUUID, err := r.ReadByte()
+		if err != nil || hasUUID != 1 {
+			return nil
+		}
+
+	default:
+		// 1.20.2+: [ name | uuid ]
+	}
+
+	uuid, err := readUUID(r)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "player uuid: %s", err.Error())
+	}
+	hs.UUID = uuid
+
+	return nil
+}
+
+// ------------------ encoding ------------------ //
+
+// readVarInt reads a minecraft protocol VarInt
+func readVarInt(r io.ByteReader) (int, error) {
+	var value uint32
+
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		value |= uint32(b&0x7f) << (7 * i)
+
+		if b&0x80 == 0 {
+			return int(int32(value)), nil
+		}
+	}
+
+	return 0, fmt.Errorf("varint is too big")
+}
+
+// readString reads a minecraft protocol String of maximum maxLen characters
+func readString(r *bytes.Reader, maxLen int) (string, error) {
+	b, err := readBytes(r, 4*maxLen) // utf-8 characters use up to 4 bytes
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// readBytes reads a byte array prefixed with its VarInt length
+func readBytes(r *bytes.Reader, maxLen int) ([]byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || length > maxLen || length > r.Len() {
+		return nil, fmt.Errorf("unexpected length (%d)", length)
+	}
+
+	b := make([]byte, length)
+	_, err = io.ReadFull(r, b)
+
+	return b, err
+}
+
+// readUUID reads a minecraft protocol UUID and returns it in hyphenated form
+func readUUID(r *bytes.Reader) (string, error) {
+	b := make([]byte, 16)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return "", err
+	}
+
+	h := hex.EncodeToString(b)
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32], nil
+}
+
+// appendVarInt appends a minecraft protocol VarInt to data
+func appendVarInt(data []byte, value int) []byte {
+	v := uint32(value)
+
+	for {
+		if v&^0x7f == 0 {
+			return append(data, byte(v))
+		}
+
+		data = append(data, byte(v&0x7f|0x80))
+		v >>= 7
+	}
+}
+
+// appendString appends a minecraft protocol String to data
+func appendString(data []byte, s string) []byte {
+	data = appendVarInt(data, len(s))
+	return append(data, s...)
+}
+
+// buildPacket returns the packet with the specified id and data, prefixed by its length
+func buildPacket(id int, data []byte) []byte {
+	packet := appendVarInt(nil, id)
+	packet = append(packet, data...)
+
+	return append(appendVarInt(nil, len(packet)), packet...)
+}
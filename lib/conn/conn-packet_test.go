@@ -0,0 +1,168 @@
+package conn
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_VarInt(t *testing.T) {
+	tests := []struct {
+		value int
+		bytes []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+	}
+
+	for _, test := range tests {
+		if b := appendVarInt(nil, test.value); !bytes.Equal(b, test.bytes) {
+			t.Errorf("varint %d encoded as %v (expected %v)", test.value, b, test.bytes)
+		}
+
+		v, err := readVarInt(bytes.NewReader(test.bytes))
+		if err != nil {
+			t.Errorf("varint %v: %s", test.bytes, err.Error())
+		}
+		if v != test.value {
+			t.Errorf("varint %v decoded as %d (expected %d)", test.bytes, v, test.value)
+		}
+	}
+
+	// varint longer than 5 bytes
+	if _, err := readVarInt(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})); err == nil {
+		t.Errorf("varint longer than 5 bytes should not be decoded")
+	}
+}
+
+func Test_decodeHandshake(t *testing.T) {
+	// server address forwarded by BungeeCord in ip forward mode
+	bungeeAddress := "mc.example.net\x00192.168.1.5\x00c45dfca992bd4501a9d09cc9cdc50271\x00" + `[{"name":"textures","value":"` + strings.Repeat("A", 5000) + `"}]`
+
+	tests := []struct {
+		data   []byte
+		expect *Handshake
+	}{
+		{
+			[]byte{246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1},
+			&Handshake{ProtocolVersion: 758, ServerAddress: "127.0.0.1", ServerPort: 25555, NextState: STATE_STATUS},
+		},
+		{
+			[]byte{249, 5, 26, 107, 117, 98, 101, 114, 110, 101, 116, 101, 115, 46, 100, 111, 99, 107, 101, 114, 46, 105, 110, 116, 101, 114, 110, 97, 108, 99, 211, 2},
+			&Handshake{ProtocolVersion: 761, ServerAddress: "kubernetes.docker.internal", ServerPort: 25555, NextState: STATE_LOGIN},
+		},
+		{
+			append(appendString(appendVarInt(nil, 765), bungeeAddress), 99, 211, 2),
+			&Handshake{ProtocolVersion: 765, ServerAddress: bungeeAddress, ServerPort: 25555, NextState: STATE_LOGIN},
+		},
+		{
+			// server address length exceeds data
+			[]byte{246, 5, 30, 49, 50, 55},
+			nil,
+		},
+		{
+			// unknown next state
+			[]byte{246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 7},
+			nil,
+		},
+		{
+			[]byte{},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		hs := &Handshake{}
+		logMsh := hs.decodeHandshake(test.data)
+
+		switch {
+		case test.expect == nil && logMsh == nil:
+			t.Errorf("handshake %v should not be decoded", test.data)
+		case test.expect != nil && logMsh != nil:
+			t.Errorf("handshake %v: "+logMsh.Mex, append([]interface{}{test.data}, logMsh.Arg...)...)
+		case test.expect != nil && !reflect.DeepEqual(hs, test.expect):
+			t.Errorf("handshake %v decoded as %+v (expected %+v)", test.data, hs, test.expect)
+		}
+	}
+}
+
+func Test_decodeLoginStart(t *testing.T) {
+	uuid := []byte{196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113}
+	name := []byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57}
+
+	tests := []struct {
+		protocol int
+		data     []byte
+		uuid     string
+	}{
+		// 1.18.2
+		{758, name, ""},
+		// 1.19 (no signature data)
+		{759, append(append([]byte{}, name...), 0), ""},
+		// 1.19.2 (no signature data, uuid)
+		{760, append(append(append([]byte{}, name...), 0, 1), uuid...), "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+		// 1.19.3 (uuid)
+		{761, append(append(append([]byte{}, name...), 1), uuid...), "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+		// 1.19.3 (no uuid)
+		{761, append(append([]byte{}, name...), 0), ""},
+		// 1.20.2
+		{764, append(append([]byte{}, name...), uuid...), "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+	}
+
+	for _, test := range tests {
+		hs := &Handshake{ProtocolVersion: test.protocol}
+
+		logMsh := hs.decodeLoginStart(test.data)
+		if logMsh != nil {
+			t.Errorf("login start (protocol %d): "+logMsh.Mex, append([]interface{}{test.protocol}, logMsh.Arg...)...)
+			continue
+		}
+
+		if hs.Username != "gekigek99" || hs.UUID != test.uuid {
+			t.Errorf("login start (protocol %d) decoded as %s %s (expected gekigek99 %s)", test.protocol, hs.Username, hs.UUID, test.uuid)
+		}
+	}
+}
+
+func Test_readHandshake_split(t *testing.T) {
+	uuid := []byte{196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113}
+	handshake := buildPacket(0x00, []byte{252, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2})
+	loginStart := buildPacket(0x00, append(appendString(nil, "gekigek99"), uuid...))
+	data := append(append([]byte{}, handshake...), loginStart...)
+
+	client, msh := net.Pipe()
+	defer client.Close()
+	defer msh.Close()
+
+	// the client sends the handshake and login start packets split across many reads
+	go func() {
+		for _, b := range data {
+			if _, err := client.Write([]byte{b}); err != nil {
+				return
+			}
+		}
+	}()
+
+	hs, logMsh := readHandshake(msh)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	switch {
+	case hs.ProtocolVersion != 764 || hs.ServerAddress != "127.0.0.1" || hs.ServerPort != 25555 || hs.NextState != STATE_LOGIN:
+		t.Errorf("handshake decoded as %+v", hs)
+	case hs.Username != "gekigek99" || hs.UUID != "c45dfca9-92bd-4501-a9d0-9cc9cdc50271":
+		t.Errorf("login start decoded as %s %s", hs.Username, hs.UUID)
+	case !bytes.Equal(hs.Raw, data):
+		t.Errorf("raw data is %v (expected %v)", hs.Raw, data)
+	}
+}
@@ -2,6 +2,8 @@ package conn
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"testing"
@@ -9,6 +11,8 @@ import (
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
 )
 
 type test struct {
@@ -101,12 +105,13 @@ func Test_getReqType(t *testing.T) {
 	}
 
 	// open a listener and read request type for each new connection
+	// (listener is opened before dialing so that the first connection is not refused)
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer listener.Close()
 	go func() {
-		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
-		if err != nil {
-			t.Errorf("%s\n", err.Error())
-		}
-
 		for _, test := range tests {
 			clientConn, err := listener.Accept()
 			if err != nil {
@@ -222,14 +227,18 @@ func Test_getPing(t *testing.T) {
 	}
 
 	// emulate msh ping response
+	// (listener is opened before dialing so that the first connection is not refused)
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer listener.Close()
 	go func() {
-		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
-		if err != nil {
-			t.Errorf("%s\n", err.Error())
-		}
-
 		for {
 			clientConn, err := listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			if err != nil {
 				t.Errorf("%s\n", err.Error())
 				continue
@@ -276,3 +285,39 @@ func Test_getPing(t *testing.T) {
 		serverSocket.Close()
 	}
 }
+
+func Test_buildStatus(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Config.Server.Version = "1.18.2"
+	srv.Config.Server.Protocol = 758
+
+	// no status cache: msh status
+	status := buildStatus(srv, "hibernating")
+	if status["version"].(map[string]interface{})["protocol"] != 758 {
+		t.Errorf("status version should be the config one: %v", status["version"])
+	}
+
+	// status cache: cached status with msh description
+	srv.Stats.StatusCache = []byte(`{"version":{"name":"Paper 1.20.4","protocol":765},"players":{"max":20,"online":3,"sample":[{"name":"gekigek99","id":"c45dfca9-92bd-4501-a9d0-9cc9cdc50271"}]},"description":{"text":"","extra":[{"text":"my server","color":"gold"}]},"favicon":"data:image/png;base64,AAAA"}`)
+
+	status = buildStatus(srv, "hibernating")
+	players := status["players"].(map[string]interface{})
+	switch {
+	case status["version"].(map[string]interface{})["protocol"] != float64(765):
+		t.Errorf("status version should be the cached one: %v", status["version"])
+	case players["max"] != float64(20) || players["online"] != 0:
+		t.Errorf("status players should be the cached ones with no player online: %v", players)
+	case players["sample"] != nil:
+		t.Errorf("status players sample should be dropped: %v", players)
+	case string(status["description"].(json.RawMessage)) != `{"extra":[{"extra":[{"color":"gold","text":"my server"}],"text":""},{"text":"\n"},{"text":"","extra":[{"text":"hibernating"}]}],"text":""}`:
+		t.Errorf("status description should be the cached one followed by message: %s", status["description"])
+	case status["favicon"] != "data:image/png;base64,AAAA":
+		t.Errorf("status favicon should be the cached one: %v", status["favicon"])
+	}
+
+	// user specified frozen icon has priority
+	srv.Config.ServerIcon, srv.Config.ServerIconSet = "BBBB", true
+	if status = buildStatus(srv, "hibernating"); status["favicon"] != "data:image/png;base64,BBBB" {
+		t.Errorf("status favicon should be the frozen one: %v", status["favicon"])
+	}
+}
@@ -0,0 +1,197 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/utility"
+)
+
+// reference:
+// - haproxy.org/download/2.8/doc/proxy-protocol.txt
+
+// proxiedConn is a client connection received through a proxy/load balancer.
+// RemoteAddr and LocalAddr return the addresses reported in the PROXY protocol header.
+type proxiedConn struct {
+	net.Conn
+	remoteAddr net.Addr // original client address
+	localAddr  net.Addr // original destination address
+}
+
+// RemoteAddr returns the original client address
+func (pc *proxiedConn) RemoteAddr() net.Addr {
+	return pc.remoteAddr
+}
+
+// LocalAddr returns the original destination address
+func (pc *proxiedConn) LocalAddr() net.Addr {
+	return pc.localAddr
+}
+
+// isTrustedProxy checks if the peer address of a connection is one of the trusted proxies.
+// Trusted proxies can be specified as IP addresses (127.0.0.1, ::1) or CIDR ranges (10.0.0.0/8).
+func isTrustedProxy(addr net.Addr, trusted []string) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, t := range trusted {
+		if strings.Contains(t, "/") {
+			_, ipNet, err := net.ParseCIDR(t)
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "trusted proxy %s is not a valid CIDR range", t)
+				continue
+			}
+			if ipNet.Contains(tcpAddr.IP) {
+				return true
+			}
+		} else if net.ParseIP(t).Equal(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readProxyHeader reads the PROXY protocol (v1 or v2) header sent by a proxy/load balancer
+// and returns the client connection with the original client and destination addresses.
+//
+// If the header does not contain addresses (v1 UNKNOWN, v2 LOCAL) the connection addresses are kept.
+func readProxyHeader(clientConn net.Conn) (net.Conn, *errco.MshLog) {
+	// set deadline to avoid hanging when proxy is not sending the header
+	clientConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	defer clientConn.SetReadDeadline(time.Time{})
+
+	// read the first byte to detect the header version
+	// (only the bytes belonging to the header are read, the remaining ones are minecraft protocol data)
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(clientConn, first); err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	}
+
+	var src, dst net.Addr
+	var logMsh *errco.MshLog
+
+	switch first[0] {
+	case 'P':
+		src, dst, logMsh = readProxyHeaderV1(clientConn)
+	case utility.ProxyProtSigV2[0]:
+		src, dst, logMsh = readProxyHeaderV2(clientConn)
+	default:
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol header not found (first byte: %v)", first)
+	}
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	if src == nil || dst == nil {
+		// header without addresses: connection was initiated by the proxy itself (health check)
+		return clientConn, nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "PROXY protocol header received: %s --> %s (proxy: %s)", src.String(), dst.String(), clientConn.RemoteAddr().String())
+
+	return &proxiedConn{Conn: clientConn, remoteAddr: src, localAddr: dst}, nil
+}
+
+// readProxyHeaderV1 reads the human-readable PROXY protocol v1 header (after the first byte)
+//
+// example: "PROXY TCP4 192.168.0.1 192.168.0.11 56324 25565\r\n"
+func readProxyHeaderV1(clientConn net.Conn) (net.Addr, net.Addr, *errco.MshLog) {
+	line := []byte{'P'}
+	b := make([]byte, 1)
+
+	// v1 header is at most 107 bytes long
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= 107 {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v1 header too long")
+		}
+		if _, err := io.ReadFull(clientConn, b); err != nil {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v1 header malformed: %q", line)
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v1 header malformed: %q", line)
+		}
+
+		srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+		srcPort, errSrc := strconv.ParseUint(fields[4], 10, 16)
+		dstPort, errDst := strconv.ParseUint(fields[5], 10, 16)
+		if srcIP == nil || dstIP == nil || errSrc != nil || errDst != nil {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v1 header malformed: %q", line)
+		}
+
+		return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+
+	default:
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v1 protocol not supported: %s", fields[1])
+	}
+}
+
+// readProxyHeaderV2 reads the binary PROXY protocol v2 header (after the first byte)
+func readProxyHeaderV2(clientConn net.Conn) (net.Addr, net.Addr, *errco.MshLog) {
+	// header: [ signature (12) | version/command (1) | family/protocol (1) | addresses length (2) | addresses ]
+	header := make([]byte, 15)
+	if _, err := io.ReadFull(clientConn, header); err != nil {
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	}
+	header = append([]byte{utility.ProxyProtSigV2[0]}, header...)
+
+	if !bytes.Equal(header[:12], utility.ProxyProtSigV2) {
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v2 signature malformed: %v", header[:12])
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol version not supported: %d", header[12]>>4)
+	}
+
+	addrs := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(clientConn, addrs); err != nil {
+		return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	}
+
+	// LOCAL command: connection established by the proxy itself
+	if header[12]&0x0f == 0x00 {
+		return nil, nil, nil
+	}
+
+	// only TCP over IPv4/IPv6 is supported, other families are handled as LOCAL
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(addrs) < 12 {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v2 IPv4 addresses too short")
+		}
+		src := &net.TCPAddr{IP: net.IP(addrs[0:4]), Port: int(binary.BigEndian.Uint16(addrs[8:10]))}
+		dst := &net.TCPAddr{IP: net.IP(addrs[4:8]), Port: int(binary.BigEndian.Uint16(addrs[10:12]))}
+		return src, dst, nil
+
+	case 0x21: // TCP over IPv6
+		if len(addrs) < 36 {
+			return nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY protocol v2 IPv6 addresses too short")
+		}
+		src := &net.TCPAddr{IP: net.IP(addrs[0:16]), Port: int(binary.BigEndian.Uint16(addrs[32:34]))}
+		dst := &net.TCPAddr{IP: net.IP(addrs[16:32]), Port: int(binary.BigEndian.Uint16(addrs[34:36]))}
+		return src, dst, nil
+
+	default:
+		return nil, nil, nil
+	}
+}
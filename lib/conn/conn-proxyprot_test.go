@@ -0,0 +1,127 @@
+package conn
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"msh/lib/utility"
+)
+
+func Test_readProxyHeader(t *testing.T) {
+	tests := []struct {
+		title  string
+		header []byte
+		remote string // expected client address ("" if connection address should be kept)
+		ok     bool
+	}{
+		{
+			"v1 tcp4",
+			[]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 25565\r\n"),
+			"192.168.0.1:56324",
+			true,
+		},
+		{
+			"v1 tcp6",
+			[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 25565\r\n"),
+			"[2001:db8::1]:56324",
+			true,
+		},
+		{
+			"v1 unknown",
+			[]byte("PROXY UNKNOWN\r\n"),
+			"",
+			true,
+		},
+		{
+			"v1 malformed",
+			[]byte("PROXY TCP4 192.168.0.1\r\n"),
+			"",
+			false,
+		},
+		{
+			"v2 tcp4",
+			utility.BuildProxyHeaderV2(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 25555}),
+			"10.1.2.3:40000",
+			true,
+		},
+		{
+			"v2 tcp6",
+			utility.BuildProxyHeaderV2(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 25555}),
+			"[2001:db8::1]:40000",
+			true,
+		},
+		{
+			"v2 local",
+			utility.BuildProxyHeaderV2(nil, nil),
+			"",
+			true,
+		},
+		{
+			"no header",
+			[]byte{16, 0, 246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1},
+			"",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		client, proxy := net.Pipe()
+
+		// the header is followed by minecraft protocol data that must not be consumed
+		go func(header []byte) {
+			proxy.Write(append(header, 1, 0))
+		}(test.header)
+
+		conn, logMsh := readProxyHeader(client)
+
+		switch {
+		case !test.ok:
+			if logMsh == nil {
+				t.Errorf("%s: header should not be accepted", test.title)
+			}
+
+		case logMsh != nil:
+			t.Errorf("%s: "+logMsh.Mex, append([]interface{}{test.title}, logMsh.Arg...)...)
+
+		default:
+			if test.remote != "" && conn.RemoteAddr().String() != test.remote {
+				t.Errorf("%s: client address is %s (expected %s)", test.title, conn.RemoteAddr().String(), test.remote)
+			}
+			if test.remote == "" && conn.RemoteAddr() != client.RemoteAddr() {
+				t.Errorf("%s: client address should not be changed", test.title)
+			}
+
+			data := make([]byte, 2)
+			if _, err := io.ReadFull(conn, data); err != nil || !bytes.Equal(data, []byte{1, 0}) {
+				t.Errorf("%s: data after header was consumed (%v)", test.title, data)
+			}
+		}
+
+		client.Close()
+		proxy.Close()
+	}
+}
+
+func Test_isTrustedProxy(t *testing.T) {
+	trusted := []string{"127.0.0.1", "10.0.0.0/8", "::1", "not-an-ip/8"}
+
+	tests := []struct {
+		addr    net.Addr
+		trusted bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40000}, true},
+		{&net.TCPAddr{IP: net.ParseIP("10.20.30.40"), Port: 40000}, true},
+		{&net.TCPAddr{IP: net.ParseIP("::1"), Port: 40000}, true},
+		{&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 40000}, false},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}, false},
+		{&net.UnixAddr{Name: "/tmp/msh.sock"}, false},
+	}
+
+	for _, test := range tests {
+		if trusted := isTrustedProxy(test.addr, trusted); trusted != test.trusted {
+			t.Errorf("%s: trusted is %t (expected %t)", test.addr.String(), trusted, test.trusted)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package conn
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -46,13 +47,21 @@ func HandlerQuery() {
 		return
 	}
 
-	// infinite cycle to handle new clients queries
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients queries on", config.MshHost, config.MshPortQuery)
+	serveQuery(connCli)
+}
+
+// serveQuery handles the query stats requests received on connCli until it's closed
+func serveQuery(connCli net.PacketConn) {
+	// infinite cycle to handle new clients queries
 	for {
 		// handshake / stats request read
 		var buf []byte = make([]byte, 1024)
 		n, addrCli, err := connCli.ReadFrom(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
 			continue
 		}
@@ -100,7 +109,7 @@ func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *err
 		}
 
 		// if ms is not warm emulate response
-		logMsh := servctrl.CheckMSWarm()
+		logMsh := servctrl.Default.CheckMSWarm()
 		if logMsh != nil {
 			switch len(reqClient) {
 			case 11: // base stats response
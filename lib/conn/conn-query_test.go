@@ -2,6 +2,7 @@ package conn
 
 import (
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -13,7 +14,13 @@ import (
 func Test_QueryFull(t *testing.T) {
 	config.MshHost, config.MshPortQuery = "127.0.0.1", 25555
 
-	go HandlerQuery()
+	// open the query listener before querying so that the first query is not refused
+	connCli, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPortQuery))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer connCli.Close()
+	go serveQuery(connCli)
 
 	minequery.WithUseStrict(true)
 
@@ -34,7 +41,13 @@ func Test_QueryFull(t *testing.T) {
 func Test_QueryBasic(t *testing.T) {
 	config.MshHost, config.MshPortQuery = "127.0.0.1", 25555
 
-	go HandlerQuery()
+	// open the query listener before querying so that the first query is not refused
+	connCli, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPortQuery))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer connCli.Close()
+	go serveQuery(connCli)
 
 	minequery.WithUseStrict(true)
 
@@ -0,0 +1,280 @@
+package conn
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servctrl"
+	"msh/lib/utility"
+)
+
+// reference:
+// - minecraft.wiki/w/Raw_JSON_text_format
+// - docs.advntr.dev/minimessage/format.html
+
+// namedColors are the minecraft chat color names
+var namedColors []string = []string{
+	"black", "dark_blue", "dark_green", "dark_aqua", "dark_red", "dark_purple", "gold", "gray",
+	"dark_gray", "blue", "green", "aqua", "red", "light_purple", "yellow", "white",
+}
+
+// hexColor matches a hex color (#rrggbb)
+var hexColor *regexp.Regexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// formatMessage replaces the placeholders in message and returns it as chat component json.
+//
+// message can be:
+// - chat component json: {"text":"hello","color":"gold"}
+// - MiniMessage markup: <gold>hello <bold>world</bold></gold>
+// - legacy text: &6hello §lworld
+func formatMessage(srv *servctrl.Server, message string) json.RawMessage {
+	// chat component json
+	// (checked before replacing placeholders: values are json escaped so that the message stays valid)
+	if config.IsJSONMessage(message) {
+		return json.RawMessage(replacePlaceholders(srv, strings.TrimSpace(message), true))
+	}
+
+	// replace "\\n" with "\n" in case the new line was set as msh parameter
+	message = strings.ReplaceAll(message, "\\n", "\n")
+
+	data, err := json.Marshal(parseMiniMessage(replacePlaceholders(srv, message, false)))
+	if err != nil {
+		// don't return error, just log a warning
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		return json.RawMessage(`{"text":""}`)
+	}
+
+	return data
+}
+
+// replacePlaceholders replaces the runtime placeholders in message.
+// If escapeJSON is true the values are escaped to be placed inside a json string.
+func replacePlaceholders(srv *servctrl.Server, message string, escapeJSON bool) string {
+	lastOnline := "never"
+	switch {
+	case srv.Stats.Status == errco.SERVER_STATUS_ONLINE && !srv.Stats.Suspended:
+		lastOnline = "now"
+	case !srv.Stats.LastOnline.IsZero():
+		lastOnline = utility.HumanDuration(time.Since(srv.Stats.LastOnline)) + " ago"
+	}
+
+	eta := "unknown"
+	switch d := srv.BootETA(); {
+	case d == 0:
+		eta = "a few seconds"
+	case d > 0:
+		eta = "~" + utility.HumanDuration(d)
+	}
+
+	placeholders := map[string]string{
+		"{progress}":   srv.Stats.LoadProgress,
+		"{eta}":        eta,
+		"{lastOnline}": lastOnline,
+		"{players}":    strconv.Itoa(srv.Stats.ConnCount),
+		"{version}":    srv.Config.Server.Version,
+	}
+
+	for p, v := range placeholders {
+		if escapeJSON {
+			e, _ := json.Marshal(v)
+			v = string(e[1 : len(e)-1])
+		}
+		message = strings.ReplaceAll(message, p, v)
+	}
+
+	return message
+}
+
+// parseMiniMessage converts MiniMessage markup into a chat component.
+//
+// Supported tags: colors (<red>, <#ff5555>, <color:red>), decorations (<bold>, <b>, <italic>, <i>,
+// <underlined>, <u>, <strikethrough>, <st>, <obfuscated>, <obf>), <reset>, <newline>, <br>,
+// <hover:show_text:'text'>, <click:action:'value'>.
+// Unknown tags are kept as text, legacy "&" color codes are converted to "§".
+func parseMiniMessage(s string) *model.ChatComponent {
+	root := &model.ChatComponent{Text: "", Extra: []model.ChatComponent{}}
+
+	// stack of opened tags
+	type tag struct {
+		name  string
+		apply func(*model.ChatComponent)
+	}
+	stack := []tag{}
+
+	var text strings.Builder
+
+	// flush adds the text read so far to root, styled by the opened tags
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		c := model.ChatComponent{Text: strings.ReplaceAll(text.String(), "&", "§")}
+		for _, t := range stack {
+			t.apply(&c)
+		}
+		root.Extra = append(root.Extra, c)
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); i++ {
+		// escaped tag
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '<' {
+			text.WriteByte('<')
+			i++
+			continue
+		}
+
+		if s[i] != '<' {
+			text.WriteByte(s[i])
+			continue
+		}
+
+		end := tagEnd(s, i)
+		if end < 0 {
+			// not a tag
+			text.WriteByte('<')
+			continue
+		}
+
+		content := s[i+1 : end]
+		args := tagArgs(content)
+		name := strings.ToLower(args[0])
+
+		var apply func(*model.ChatComponent)
+
+		switch {
+		case strings.HasPrefix(name, "/"):
+			// closing tag: close the last tag with the same name (or the last one for "</>")
+			flush()
+			closing := strings.TrimPrefix(name, "/")
+			for j := len(stack) - 1; j >= 0; j-- {
+				if closing == "" || stack[j].name == closing {
+					stack = stack[:j]
+					break
+				}
+			}
+			i = end
+			continue
+
+		case name == "reset":
+			flush()
+			stack = []tag{}
+			i = end
+			continue
+
+		case name == "newline" || name == "br":
+			text.WriteByte('\n')
+			i = end
+			continue
+
+		case utility.SliceContain(name, namedColors) || hexColor.MatchString(name):
+			color := name
+			apply = func(c *model.ChatComponent) { c.Color = color }
+
+		case (name == "color" || name == "colour" || name == "c") && len(args) == 2:
+			color := strings.ToLower(args[1])
+			name = "color"
+			apply = func(c *model.ChatComponent) { c.Color = color }
+
+		case name == "bold" || name == "b":
+			name = "bold"
+			apply = func(c *model.ChatComponent) { c.Bold = true }
+
+		case name == "italic" || name == "i" || name == "em":
+			name = "italic"
+			apply = func(c *model.ChatComponent) { c.Italic = true }
+
+		case name == "underlined" || name == "u":
+			name = "underlined"
+			apply = func(c *model.ChatComponent) { c.Underlined = true }
+
+		case name == "strikethrough" || name == "st":
+			name = "strikethrough"
+			apply = func(c *model.ChatComponent) { c.Strikethrough = true }
+
+		case name == "obfuscated" || name == "obf":
+			name = "obfuscated"
+			apply = func(c *model.ChatComponent) { c.Obfuscated = true }
+
+		case name == "hover" && len(args) >= 3 && args[1] == "show_text":
+			hover := &model.HoverEvent{Action: "show_text", Contents: parseMiniMessage(strings.Join(args[2:], ":"))}
+			apply = func(c *model.ChatComponent) { c.HoverEvent = hover }
+
+		case name == "click" && len(args) >= 3:
+			click := &model.ClickEvent{Action: args[1], Value: strings.Join(args[2:], ":")}
+			apply = func(c *model.ChatComponent) { c.ClickEvent = click }
+
+		default:
+			// unknown tag: keep it as text
+			text.WriteString(s[i : end+1])
+			i = end
+			continue
+		}
+
+		flush()
+		stack = append(stack, tag{name: name, apply: apply})
+		i = end
+	}
+
+	flush()
+
+	return root
+}
+
+// tagEnd returns the index of the ">" closing the tag that starts at index start ("<").
+// Quoted arguments can contain ">". Returns -1 if the tag is not closed.
+func tagEnd(s string, start int) int {
+	var quote byte
+
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == '<':
+			// a new tag starts before this one is closed: not a tag
+			return -1
+		case s[i] == '>':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// tagArgs splits the tag content by ":" (quoted arguments can contain ":") and removes quotes
+func tagArgs(content string) []string {
+	args := []string{}
+
+	var arg strings.Builder
+	var quote byte
+
+	for i := 0; i < len(content); i++ {
+		switch {
+		case quote != 0:
+			if content[i] == quote {
+				quote = 0
+			} else {
+				arg.WriteByte(content[i])
+			}
+		case content[i] == '\'' || content[i] == '"':
+			quote = content[i]
+		case content[i] == ':':
+			args = append(args, arg.String())
+			arg.Reset()
+		default:
+			arg.WriteByte(content[i])
+		}
+	}
+
+	return append(args, arg.String())
+}
@@ -0,0 +1,75 @@
+package conn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+func Test_formatMessage(t *testing.T) {
+	srv := &servctrl.Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	srv.Config.Server.Version = "1.20.4"
+	srv.Stats.Status = errco.SERVER_STATUS_STARTING
+	srv.Stats.LoadProgress = "42%"
+	srv.Stats.LastOnline = time.Now().Add(-2 * time.Hour)
+
+	tests := []struct {
+		message string
+		expect  string
+	}{
+		// legacy text
+		{
+			"&fServer Status:\\n§b§lHIBERNATING",
+			`{"text":"","extra":[{"text":"§fServer Status:\n§b§lHIBERNATING"}]}`,
+		},
+		// placeholders
+		{
+			"loading {progress} ({version}, last online {lastOnline})",
+			`{"text":"","extra":[{"text":"loading 42% (1.20.4, last online 2h ago)"}]}`,
+		},
+		// chat component json
+		{
+			`{"text":"loading {progress}","color":"#ff5555","bold":true}`,
+			`{"text":"loading 42%","color":"#ff5555","bold":true}`,
+		},
+		// text starting like json
+		{
+			"{progress} loaded",
+			`{"text":"","extra":[{"text":"42% loaded"}]}`,
+		},
+		{
+			"[MSH] hibernating",
+			`{"text":"","extra":[{"text":"[MSH] hibernating"}]}`,
+		},
+		// MiniMessage markup
+		{
+			"<gold>hello <bold>world</bold></gold><newline><#00ff00>green",
+			`{"text":"","extra":[{"text":"hello ","color":"gold"},{"text":"world","color":"gold","bold":true},{"text":"\n"},{"text":"green","color":"#00ff00"}]}`,
+		},
+		{
+			"<hover:show_text:'<red>click me'><click:open_url:'https://example.net'>link</click></hover>",
+			`{"text":"","extra":[{"text":"link","hoverEvent":{"action":"show_text","contents":{"text":"","extra":[{"text":"click me","color":"red"}]}},"clickEvent":{"action":"open_url","value":"https://example.net"}}]}`,
+		},
+		// unknown tags and lone "<" are kept as text
+		{
+			"1 < 2 <unknown>",
+			`{"text":"","extra":[{"text":"1 \u003c 2 \u003cunknown\u003e"}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		mes := formatMessage(srv, test.message)
+
+		if !json.Valid(mes) {
+			t.Errorf("message %q formatted as invalid json: %s", test.message, mes)
+		}
+		if string(mes) != test.expect {
+			t.Errorf("message %q formatted as:\n%s\nexpected:\n%s", test.message, mes, test.expect)
+		}
+	}
+}
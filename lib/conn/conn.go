@@ -3,13 +3,15 @@ package conn
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/events"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
+	"msh/lib/utility"
 )
 
 func init() {
@@ -21,20 +23,40 @@ func init() {
 // If there is a ms major error, it is reported to client then func returns.
 // [goroutine]
 func HandlerClientConn(clientConn net.Conn) {
+	// get real client address from PROXY protocol header sent by proxy/load balancer
+	// (only trusted proxies can set the client address)
+	if config.ConfigRuntime.Msh.AcceptProxyProtocol {
+		if isTrustedProxy(clientConn.RemoteAddr(), config.ConfigRuntime.Msh.ProxyProtocolTrusted) {
+			proxiedConn, logMsh := readProxyHeader(clientConn)
+			if logMsh != nil {
+				logMsh.Log(true)
+				clientConn.Close()
+				return
+			}
+			clientConn = proxiedConn
+		} else {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s is not a trusted proxy: PROXY protocol header is not read", clientConn.RemoteAddr().String())
+		}
+	}
+
 	// handling of ipv6 addresses
 	li := strings.LastIndex(clientConn.RemoteAddr().String(), ":")
 	clientAddress := clientConn.RemoteAddr().String()[:li]
 
 	// get request type from client
-	reqPacket, reqType, logMsh := getReqType(clientConn)
+	hs, reqType, logMsh := getReqType(clientConn)
 	if logMsh != nil {
 		logMsh.Log(true)
 		return
 	}
 
+	// route client to the minecraft server matching the requested server address
+	srv := servctrl.Route(hs.ServerAddress)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s routed to minecraft server: %s", clientAddress, srv.Name)
+
 	// if there is a major error warn the client and return
-	if servstats.Stats.MajorError != nil {
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+	if srv.Stats.MajorError != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", clientAddress, config.MshPort, srv.Config.ServHost, srv.Config.ServPort)
 
 		// close the client connection before returning
 		defer func() {
@@ -43,7 +65,11 @@ func HandlerClientConn(clientConn net.Conn) {
 		}()
 
 		// msh INFO/JOIN response (warn client with error description)
-		mes := buildMessage(reqType, fmt.Sprintf(servstats.Stats.MajorError.Mex, servstats.Stats.MajorError.Arg...))
+		description := fmt.Sprintf(srv.Stats.MajorError.Mex, srv.Stats.MajorError.Arg...)
+		if srv.CrashLoop() {
+			description = srv.Config.Msh.InfoCrashLoop
+		}
+		mes := buildMessage(srv, reqType, description)
 		clientConn.Write(mes)
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
@@ -61,9 +87,9 @@ func HandlerClientConn(clientConn net.Conn) {
 	// handle the request depending on request type
 	switch reqType {
 	case errco.CLIENT_REQ_INFO:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client requested server info from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client requested server info from %s:%d to %s:%d", clientAddress, config.MshPort, srv.Config.ServHost, srv.Config.ServPort)
 
-		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended {
+		if srv.Stats.Status != errco.SERVER_STATUS_ONLINE || srv.Stats.Suspended {
 			// ms not online or suspended
 
 			defer func() {
@@ -74,17 +100,22 @@ func HandlerClientConn(clientConn net.Conn) {
 
 			// msh INFO response
 			var mes []byte
+			scheduleMessage, hibernating := srv.ScheduleHibernation()
 			switch {
-			case servstats.Stats.Status == errco.SERVER_STATUS_SUSPENDED || servstats.Stats.Suspended:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoSuspended)
-			case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
-			case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoStarting)
-			case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
-				mes = buildMessage(reqType, "server is stopping...\nrefresh the page")
+			case srv.Stats.Status == errco.SERVER_STATUS_SUSPENDED || srv.Stats.Suspended:
+				mes = buildMessage(srv, reqType, srv.Config.Msh.InfoSuspended)
+			case srv.Stats.Status == errco.SERVER_STATUS_OFFLINE && srv.BackingUp():
+				mes = buildMessage(srv, reqType, srv.Config.Msh.InfoBackup)
+			case srv.Stats.Status == errco.SERVER_STATUS_OFFLINE && hibernating:
+				mes = buildMessage(srv, reqType, scheduleMessage)
+			case srv.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+				mes = buildMessage(srv, reqType, srv.Config.Msh.InfoHibernation)
+			case srv.Stats.Status == errco.SERVER_STATUS_STARTING:
+				mes = buildMessage(srv, reqType, srv.Config.Msh.InfoStarting)
+			case srv.Stats.Status == errco.SERVER_STATUS_STOPPING:
+				mes = buildMessage(srv, reqType, "server is stopping...\nrefresh the page")
 			default:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
+				mes = buildMessage(srv, reqType, srv.Config.Msh.InfoHibernation)
 			}
 			clientConn.Write(mes)
 			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
@@ -100,37 +131,89 @@ func HandlerClientConn(clientConn net.Conn) {
 			// ms online and not suspended
 
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_INFO)
+			openProxy(srv, clientConn, hs.Raw, errco.CLIENT_REQ_INFO)
 		}
 
 	case errco.CLIENT_REQ_JOIN:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client tried to join from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client tried to join from %s:%d to %s:%d", clientAddress, config.MshPort, srv.Config.ServHost, srv.Config.ServPort)
 
-		// Check for whitelist first as it applies in all cases
-		// check if the request packet contains element of whitelist or the address is in whitelist
-		logMsh := config.ConfigRuntime.IsWhitelist(reqPacket, clientAddress)
+		// Check for bans first as they apply in all cases (also while minecraft server is hibernating)
+		reason, logMsh := srv.Config.IsBanned(hs.Username, hs.UUID, clientAddress)
 		if logMsh != nil {
 			logMsh.Log(true)
 
-			// Close connection later
-			defer func() {
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
-				clientConn.Close()
-			}()
-
-			// msh JOIN response (warn client with text in the loadscreen)
-			mes := buildMessage(reqType, "You don't have permission to warm this server")
-			clientConn.Write(mes)
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+			var mes []byte
+			switch logMsh.Cod {
+			case errco.ERROR_BANNED_IP:
+				mes = buildMessage(srv, reqType, "Your IP address is banned from this server.\nReason: "+reason)
+			default:
+				mes = buildMessage(srv, reqType, "You are banned from this server.\nReason: "+reason)
+			}
+			kickClient(clientConn, clientAddress, mes)
 
 			return
 		}
 
+		// check if player name, player uuid or client address are in whitelist
+		// (a player that is allowed to join the running server might not be allowed to wake it)
+		if srv.Stats.Status == errco.SERVER_STATUS_ONLINE && !srv.Stats.Suspended {
+			logMsh = srv.Config.IsWhitelistJoin(hs.Username, hs.UUID, clientAddress)
+			if logMsh != nil {
+				logMsh.Log(true)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				kickClient(clientConn, clientAddress, buildMessage(srv, reqType, "You are not whitelisted on this server"))
+
+				return
+			}
+		} else {
+			logMsh = srv.Config.IsWhitelist(hs.Username, hs.UUID, clientAddress)
+			if logMsh != nil {
+				logMsh.Log(true)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				kickClient(clientConn, clientAddress, buildMessage(srv, reqType, "You don't have permission to wake this server"))
+
+				return
+			}
+		}
+
+		if srv.Stats.Status == errco.SERVER_STATUS_OFFLINE || srv.Stats.Status == errco.SERVER_STATUS_SUSPENDED || srv.Stats.Suspended {
+			// ms can't be woken while its world is being backed up
+			if srv.BackingUp() {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s can't wake minecraft server during world backup", clientAddress)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				kickClient(clientConn, clientAddress, buildMessage(srv, reqType, srv.Config.Msh.InfoBackup))
+
+				return
+			}
+
+			// hibernating ms can't be woken during a hibernate window
+			if scheduleMessage, hibernating := srv.ScheduleHibernation(); hibernating {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s can't wake minecraft server during hibernate window", clientAddress)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				kickClient(clientConn, clientAddress, buildMessage(srv, reqType, scheduleMessage))
+
+				return
+			}
+
+			// notify who is waking the hibernating ms
+			events.Publish(events.WAKE, srv.Name, map[string]interface{}{"player": hs.Username, "address": clientAddress})
+		}
+
+		// a client transferred by msh reconnects with transfer intent: ms receives it as a normal login
+		joinPacket := hs.Raw
+		if srv.Config.Msh.HoldTransfer || srv.Config.Msh.Limbo {
+			joinPacket = hs.loginRaw()
+		}
+
 		// Check server status
 		switch {
-		case servstats.Stats.Status == errco.SERVER_STATUS_SUSPENDED || servstats.Stats.Suspended:
+		case srv.Stats.Status == errco.SERVER_STATUS_SUSPENDED || srv.Stats.Suspended:
 			// Server is suspended, just warm it and establish proxy
-			logMsh = servctrl.WarmMS()
+			logMsh = srv.WarmMS()
 			if logMsh != nil {
 				// Close connection on error
 				defer func() {
@@ -140,45 +223,77 @@ func HandlerClientConn(clientConn net.Conn) {
 
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
-				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
+				mes := buildMessage(srv, reqType, "An error occurred while warming the server: check the msh log")
 				clientConn.Write(mes)
 				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 				return
 			}
 
 			// Open proxy connection to the now resumed server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_JOIN)
+			openProxy(srv, clientConn, joinPacket, errco.CLIENT_REQ_JOIN)
 
-		case servstats.Stats.Status != errco.SERVER_STATUS_ONLINE:
+		case srv.Stats.Status != errco.SERVER_STATUS_ONLINE:
 			// Server is offline or starting/stopping, need to warm it first
 
-			defer func() {
-				// close the client connection before returning
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
-				clientConn.Close()
-			}()
-
 			// issue warm
-			logMsh = servctrl.WarmMS()
+			logMsh = srv.WarmMS()
 			if logMsh != nil {
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
-				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
-				clientConn.Write(mes)
-				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				kickClient(clientConn, clientAddress, buildMessage(srv, reqType, "An error occurred while warming the server: check the msh log"))
+				return
+			}
+
+			// hold the client until ms is online
+			switch {
+			case limboSupported(srv, hs.ProtocolVersion):
+				logMsh = enterLimbo(srv, clientConn, hs)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+
+				// client was transferred (it will reconnect) or can't be kept in limbo anymore
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+				clientConn.Close()
+				return
+
+			case srv.Config.Msh.HoldClient && srv.Config.Msh.HoldTransfer && hs.ProtocolVersion >= PROTOCOL_1_20_5:
+				logMsh = holdTransfer(srv, clientConn, hs)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+
+				// client was transferred (it will reconnect) or can't be held anymore
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+				clientConn.Close()
+				return
+
+			case srv.Config.Msh.HoldClient && hs.ProtocolVersion >= PROTOCOL_1_13:
+				logMsh = holdLogin(srv, clientConn, hs)
+				if logMsh != nil {
+					// msh JOIN response (warn client with text in the loadscreen)
+					logMsh.Log(true)
+					kickClient(clientConn, clientAddress, buildMessage(srv, reqType, "An error occurred while waiting for the server to start: check the msh log"))
+					return
+				}
+
+				// open proxy between client and the now online server
+				openProxy(srv, clientConn, hs.Raw, errco.CLIENT_REQ_JOIN)
 				return
 			}
 
 			// msh JOIN response (answer client with text in the loadscreen)
-			mes := buildMessage(reqType, "Server start command issued. Please wait... "+servstats.Stats.LoadProgress)
-			clientConn.Write(mes)
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+			message := "Server start command issued. Please wait... {progress}"
+			if srv.Stats.BootEstimate > 0 {
+				message += " (ready in {eta})"
+			}
+			kickClient(clientConn, clientAddress, buildMessage(srv, reqType, message))
 
 		default:
 			// Server is online and not suspended
 
 			// issue warm to ensure processes are running (might need resume)
-			logMsh = servctrl.WarmMS()
+			logMsh = srv.WarmMS()
 			if logMsh != nil {
 				// Close connection on error
 				defer func() {
@@ -188,23 +303,23 @@ func HandlerClientConn(clientConn net.Conn) {
 
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
-				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
+				mes := buildMessage(srv, reqType, "An error occurred while warming the server: check the msh log")
 				clientConn.Write(mes)
 				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 				return
 			}
 
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_JOIN)
+			openProxy(srv, clientConn, joinPacket, errco.CLIENT_REQ_JOIN)
 		}
 
 	case errco.CLIENT_REQ_FOREIGN:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client sent a foreign protocol request from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client sent a foreign protocol request from %s:%d to %s:%d", clientAddress, config.MshPort, srv.Config.ServHost, srv.Config.ServPort)
 
 		// Check server status - only forward to online servers
-		if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		if srv.Stats.Status == errco.SERVER_STATUS_ONLINE {
 			// Open proxy between client and server for the foreign protocol
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_FOREIGN)
+			openProxy(srv, clientConn, hs.Raw, errco.CLIENT_REQ_FOREIGN)
 		} else {
 			// Cannot process foreign protocol requests when server is offline
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NIL, "cannot process foreign protocol when server is offline")
@@ -212,49 +327,67 @@ func HandlerClientConn(clientConn net.Conn) {
 		}
 
 	default:
-		mes := buildMessage(reqType, "Client request unknown")
+		mes := buildMessage(srv, reqType, "Client request unknown")
 		clientConn.Write(mes)
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 	}
 }
 
+// kickClient sends the message to the client and closes the client connection
+func kickClient(clientConn net.Conn, clientAddress string, mes []byte) {
+	clientConn.Write(mes)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+	clientConn.Close()
+}
+
 // openProxy opens a proxy connections between mincraft server and mincraft client.
 //
 // It sends the request packet for ms to interpret.
 //
+// The srv parameter is the minecraft server to which the client is connected.
+//
 // The req parameter indicates what request type (INFO os JOIN) the proxy will be used for.
-func openProxy(clientConn net.Conn, serverInitPacket []byte, req int) {
+func openProxy(srv *servctrl.Server, clientConn net.Conn, serverInitPacket []byte, req int) {
 	// open a connection to ms and connect it with the client
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(srv.Config.ServHost, strconv.Itoa(srv.Config.ServPort)))
 	if err != nil {
 		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 
 		// msh JOIN response (warn client with text in the loadscreen)
-		mes := buildMessage(errco.CLIENT_REQ_JOIN, "can't connect to server... check if minecraft server is running and set the correct ServPort")
+		mes := buildMessage(srv, errco.CLIENT_REQ_JOIN, "can't connect to server... check if minecraft server is running and set the correct ServPort")
 		clientConn.Write(mes)
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 		return
 	}
 
+	// sends the PROXY protocol header so that ms knows the real client address
+	if srv.Config.Msh.SendProxyProtocol {
+		header := utility.BuildProxyHeaderV2(clientConn.RemoteAddr(), clientConn.LocalAddr())
+		serverSocket.Write(header)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> server%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, header)
+	}
+
 	// sends the request packet
 	serverSocket.Write(serverInitPacket)
 
 	// launch proxy client -> server
-	go forwardTCP(clientConn, serverSocket, false, req)
+	go forwardTCP(srv, clientConn, serverSocket, false, req)
 
 	// launch proxy server -> client
-	go forwardTCP(serverSocket, clientConn, true, req)
+	go forwardTCP(srv, serverSocket, clientConn, true, req)
 }
 
 // forwardTCP takes a source and a destination net.Conn and forwards them.
 //
 // isServerToClient used to know the forwardTCP direction
 //
-// req is used to decide if connection should be counted in servstats.Stats.ConnCount
+// req is used to decide if connection should be counted in srv.Stats.ConnCount
 //
 // [goroutine]
-func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
+func forwardTCP(srv *servctrl.Server, source, destination net.Conn, isServerToClient bool, req int) {
 	var data []byte = make([]byte, 1024)
 	var direction string
 
@@ -266,21 +399,28 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 
 	// if client has requested ms join, change connection count
 	if isServerToClient && req == errco.CLIENT_REQ_JOIN { // isServerToClient used to count in only one of the 2 forwardTCP()
-		servstats.Stats.ConnCount++
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
+		srv.Stats.ConnCount++
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections (%s)", srv.Stats.ConnCount, srv.Name)
+		events.Publish(events.PLAYER_JOINED, srv.Name, map[string]interface{}{"address": destination.RemoteAddr().String(), "connCount": srv.Stats.ConnCount})
+		srv.RecordJoin()
 
 		defer func() {
-			servstats.Stats.ConnCount--
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT DISCONNECTED FROM THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
+			srv.Stats.ConnCount--
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT DISCONNECTED FROM THE SERVER! (join req) - %d active connections (%s)", srv.Stats.ConnCount, srv.Name)
+			events.Publish(events.PLAYER_LEFT, srv.Name, map[string]interface{}{"address": destination.RemoteAddr().String(), "connCount": srv.Stats.ConnCount})
+			if srv.Stats.ConnCount == 0 {
+				events.Publish(events.EMPTY, srv.Name, nil)
+				srv.RecordEmpty()
+			}
 
-			servctrl.FreezeMSSchedule()
+			srv.FreezeMSSchedule()
 		}()
 	}
 
 	for {
 		// update read and write timeout
-		source.SetReadDeadline(time.Now().Add(time.Duration(config.ConfigRuntime.Msh.ConnectionTimeoutSeconds) * time.Second))
-		destination.SetWriteDeadline(time.Now().Add(time.Duration(config.ConfigRuntime.Msh.ConnectionTimeoutSeconds) * time.Second))
+		source.SetReadDeadline(time.Now().Add(time.Duration(srv.Config.Msh.ConnectionTimeoutSeconds) * time.Second))
+		destination.SetWriteDeadline(time.Now().Add(time.Duration(srv.Config.Msh.ConnectionTimeoutSeconds) * time.Second))
 
 		// read data from source
 		dataLen, err := source.Read(data)
@@ -304,17 +444,26 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 			return
 		}
 
+		// count bytes to client/server
+		srv.Stats.M.Lock()
+		if isServerToClient {
+			srv.Stats.BytesToClientsTotal += float64(dataLen)
+		} else {
+			srv.Stats.BytesToServerTotal += float64(dataLen)
+		}
+		srv.Stats.M.Unlock()
+
 		// calculate bytes/s to client/server
-		if config.ConfigRuntime.Msh.ShowInternetUsage && errco.DebugLvl >= errco.LVL_3 {
+		if srv.Config.Msh.ShowInternetUsage && errco.DebugLvl >= errco.LVL_3 {
 			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%s%s%s: %v", errco.COLOR_PURPLE, direction, errco.COLOR_RESET, data[:dataLen])
 
-			servstats.Stats.M.Lock()
+			srv.Stats.M.Lock()
 			if isServerToClient {
-				servstats.Stats.BytesToClients += float64(dataLen)
+				srv.Stats.BytesToClients += float64(dataLen)
 			} else {
-				servstats.Stats.BytesToServer += float64(dataLen)
+				srv.Stats.BytesToServer += float64(dataLen)
 			}
-			servstats.Stats.M.Unlock()
+			srv.Stats.M.Unlock()
 		}
 	}
 }
@@ -331,16 +480,18 @@ func printDataUsage() {
 	for {
 		<-ticker.C
 
-		if !config.ConfigRuntime.Msh.ShowInternetUsage {
-			continue
-		}
+		for _, srv := range servctrl.Servers() {
+			if !srv.Config.Msh.ShowInternetUsage {
+				continue
+			}
 
-		if servstats.Stats.BytesToClients != 0 || servstats.Stats.BytesToServer != 0 {
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "data/s: %8.3f KB/s to clients | %8.3f KB/s to server", servstats.Stats.BytesToClients/1024, servstats.Stats.BytesToServer/1024)
-			servstats.Stats.M.Lock()
-			servstats.Stats.BytesToClients = 0
-			servstats.Stats.BytesToServer = 0
-			servstats.Stats.M.Unlock()
+			if srv.Stats.BytesToClients != 0 || srv.Stats.BytesToServer != 0 {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "data/s: %8.3f KB/s to clients | %8.3f KB/s to server (%s)", srv.Stats.BytesToClients/1024, srv.Stats.BytesToServer/1024, srv.Name)
+				srv.Stats.M.Lock()
+				srv.Stats.BytesToClients = 0
+				srv.Stats.BytesToServer = 0
+				srv.Stats.M.Unlock()
+			}
 		}
 	}
 }
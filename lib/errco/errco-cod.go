@@ -13,6 +13,9 @@ package errco
 0x07xxxx: input package
 0x08xxxx: errco package
 0x09xxxx: servstats package
+0x0axxxx: api package
+0x0bxxxx: events package
+0x0cxxxx: webhook package
 */
 
 // -------------------- log -------------------- //
@@ -89,10 +92,27 @@ const (
 	ERROR_SERVER_OFFLINE_SUSPENDED LogCod = 0x00f20a // minecraft server is offline but not suspended
 	ERROR_SERVER_STOPPING          LogCod = 0x00f20b // minecraft server is stopping
 	ERROR_SERVER_UNRESPONDING      LogCod = 0x00f20c // minecraft server is not responding
+	ERROR_SERVER_STAY              LogCod = 0x00f20d // minecraft server hibernation is postponed by a player
 	ERROR_PIPE_INPUT_WRITE         LogCod = 0x00f300 // terminal input writing error
 	ERROR_PIPE_LOAD                LogCod = 0x00f301 // terminal pipe load error
 	ERROR_CONVERSION               LogCod = 0x00f400 // variable conversion error
 	ERROR_WRONG_CONNECTION_COUNT   LogCod = 0x00f500 // connection count does not correspond to ms player count
+	ERROR_STATUS_CACHE             LogCod = 0x00f600 // error while loading/saving ms status cache
+	ERROR_BOOT_HISTORY             LogCod = 0x00f601 // error while loading/saving ms boot history
+	ERROR_JOIN_HISTORY             LogCod = 0x00f602 // error while loading/saving ms join history
+	ERROR_RCON                     LogCod = 0x00f700 // error while executing rcon request
+	ERROR_RCON_DIAL                LogCod = 0x00f701 // error while dialing ms rcon
+	ERROR_RCON_AUTH                LogCod = 0x00f702 // ms rcon authentication failed
+	ERROR_ATTACH_HOOK              LogCod = 0x00f800 // error while executing attached ms start/stop hook
+	ERROR_ATTACH_PROCESS           LogCod = 0x00f801 // attached ms process (pid/cgroup) not found
+	ERROR_DOCKER                   LogCod = 0x00f900 // error while requesting docker engine api
+	ERROR_CHECKPOINT               LogCod = 0x00fa00 // error while managing ms checkpoints
+	ERROR_SCHEDULE                 LogCod = 0x00fb00 // ms warm/freeze is not allowed by schedule
+	ERROR_SCHEDULE_PARSE           LogCod = 0x00fb01 // schedule format is invalid
+	ERROR_BACKUP                   LogCod = 0x00fc00 // error while backing up ms world
+	ERROR_BACKUP_RUNNING           LogCod = 0x00fc01 // ms world backup is in progress
+	ERROR_SERVER_CRASH             LogCod = 0x00fd00 // ms crashed
+	ERROR_SERVER_CRASH_LOOP        LogCod = 0x00fd01 // ms keeps crashing after being restarted
 
 	// program manager package
 
@@ -118,6 +138,7 @@ const (
 	ERROR_QUERY_CHALLENGE     LogCod = 0x02f401 // error caused by query challenge
 	ERROR_QUERY_BAD_REQUEST   LogCod = 0x02f402 // error caused by query request
 	ERROR_PING_PACKET_UNKNOWN LogCod = 0x02f500 // error ping packet received is unknown
+	ERROR_PROXY_HEADER        LogCod = 0x02f600 // error while reading PROXY protocol header
 
 	// config package
 
@@ -128,6 +149,8 @@ const (
 	ERROR_ICON_LOAD        LogCod = 0x03f100 // error while loading icon
 	ERROR_VERSION_LOAD     LogCod = 0x03f101 // error while loading version.json from server JAR
 	ERROR_WHITELIST_CHECK  LogCod = 0x03f200 // error while checking whitelist
+	ERROR_BANNED_PLAYER    LogCod = 0x03f201 // player is banned from minecraft server
+	ERROR_BANNED_IP        LogCod = 0x03f202 // client address is banned from minecraft server
 	ERROR_TYPE_UNSUPPORTED LogCod = 0x03f300 // error interface{}.(type) not supported
 	ERROR_INVALID_COMMAND  LogCod = 0x03f400 // error start ms command is invalid
 	ERROR_PARSE            LogCod = 0x03f500 // error while parsing args
@@ -145,6 +168,9 @@ const (
 	ERROR_PROCESS_LIST            LogCod = 0x04f401 // error processes running not found
 	ERROR_PROCESS_KILL            LogCod = 0x04f402 // error process kill
 	ERROR_PROCESS_TIME            LogCod = 0x04f500 // error while retrieving process time
+	ERROR_CGROUP                  LogCod = 0x04f600 // error while managing cgroup
+	ERROR_MEMORY_RECLAIM          LogCod = 0x04f700 // error while reclaiming/prefaulting process memory
+	ERROR_CRIU                    LogCod = 0x04f800 // error while checkpointing/restoring process with criu
 
 	// utility package
 
@@ -168,4 +194,16 @@ const (
 
 	// servstats package
 	ERROR_MINECRAFT_SERVER LogCod = 0x09f000 // major error while starting minecraft server (will be communicated to clients trying to join)
+
+	// api package
+	ERROR_API_LISTEN  LogCod = 0x0af000 // error while listening for api requests
+	ERROR_API_AUTH    LogCod = 0x0af100 // api request is not authorized
+	ERROR_API_REQUEST LogCod = 0x0af101 // api request is not valid
+
+	// events package
+	ERROR_EVENT_DROPPED LogCod = 0x0bf000 // event was not delivered to a subscriber
+
+	// webhook package
+	ERROR_WEBHOOK_SEND     LogCod = 0x0cf000 // error while sending webhook request
+	ERROR_WEBHOOK_TEMPLATE LogCod = 0x0cf001 // webhook payload template is not valid json
 )
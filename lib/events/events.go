@@ -0,0 +1,84 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// event types
+const (
+	WAKE             string = "wake"             // a player joining the hibernating minecraft server woke it
+	WARMING          string = "warming"          // minecraft server start was issued
+	STARTING         string = "starting"         // minecraft server terminal started
+	ONLINE           string = "online"           // minecraft server is online
+	STOPPING         string = "stopping"         // minecraft server is stopping
+	OFFLINE          string = "offline"          // minecraft server terminal exited
+	SUSPENDED        string = "suspended"        // minecraft server process was suspended
+	RESUMED          string = "resumed"          // minecraft server process was resumed
+	CHECKPOINTED     string = "checkpointed"     // minecraft server process was checkpointed to disk
+	RESTORED         string = "restored"         // minecraft server process was restored from checkpoint
+	BACKED_UP        string = "backed_up"        // minecraft server world was backed up
+	FREEZE_SCHEDULED string = "freeze_scheduled" // soft freeze of minecraft server was scheduled
+	KILLED           string = "killed"           // minecraft server process was killed because it did not stop
+	CRASHED          string = "crashed"          // minecraft server crashed
+	CRASH_LOOP       string = "crash_loop"       // minecraft server kept crashing after being restarted (it won't be started again)
+	MAJOR_ERROR      string = "major_error"      // minecraft server encountered a major error
+	PLAYER_JOINED    string = "player_joined"    // a client joined the minecraft server
+	PLAYER_LEFT      string = "player_left"      // a client left the minecraft server
+	EMPTY            string = "empty"            // the last client left the minecraft server
+)
+
+// subscriberBuffer is the number of events buffered for each subscriber (events are dropped for slow subscribers)
+const subscriberBuffer int = 64
+
+// Event is a msh lifecycle event
+type Event struct {
+	Type   string                 `json:"type"`
+	Server string                 `json:"server"` // name of the minecraft server
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+var (
+	m           sync.Mutex
+	subscribers map[chan Event]bool = map[chan Event]bool{}
+)
+
+// Publish sends the event to all subscribers.
+// [non-blocking]
+func Publish(typ, server string, data map[string]interface{}) {
+	e := Event{Type: typ, Server: server, Time: time.Now(), Data: data}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "event: %s (%s)", typ, server)
+
+	m.Lock()
+	defer m.Unlock()
+
+	for c := range subscribers {
+		select {
+		case c <- e:
+		default:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_EVENT_DROPPED, "event %s dropped: subscriber is not receiving events", typ)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the published events.
+// The returned function must be called to unsubscribe.
+func Subscribe() (<-chan Event, func()) {
+	c := make(chan Event, subscriberBuffer)
+
+	m.Lock()
+	subscribers[c] = true
+	m.Unlock()
+
+	unsubscribe := func() {
+		m.Lock()
+		delete(subscribers, c)
+		m.Unlock()
+	}
+
+	return c, unsubscribe
+}
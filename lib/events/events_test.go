@@ -0,0 +1,35 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Publish(t *testing.T) {
+	c, unsubscribe := Subscribe()
+
+	Publish(ONLINE, "survival", map[string]interface{}{"connCount": 0})
+
+	select {
+	case e := <-c:
+		if e.Type != ONLINE || e.Server != "survival" || e.Data["connCount"] != 0 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event not received")
+	}
+
+	// a slow subscriber must not block publishers
+	for i := 0; i < subscriberBuffer+10; i++ {
+		Publish(PLAYER_JOINED, "survival", nil)
+	}
+	if len(c) != subscriberBuffer {
+		t.Errorf("subscriber buffered %d events (expected %d)", len(c), subscriberBuffer)
+	}
+
+	unsubscribe()
+
+	if len(subscribers) != 0 {
+		t.Errorf("subscriber was not removed")
+	}
+}
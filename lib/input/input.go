@@ -8,7 +8,6 @@ import (
 	"msh/lib/errco"
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 
 	"github.com/chzyer/readline"
 )
@@ -21,11 +20,11 @@ func GetInput() {
 			Prompt: "» ",
 			AutoComplete: readline.NewPrefixCompleter(
 				readline.PcItem("msh",
-					readline.PcItem("start"),
-					readline.PcItem("freeze"),
+					readline.PcItem("start", readline.PcItemDynamic(serverNames(""))),
+					readline.PcItem("freeze", readline.PcItemDynamic(serverNames(""))),
 					readline.PcItem("exit"),
 				),
-				readline.PcItem("mine"),
+				readline.PcItem("mine", readline.PcItemDynamic(serverNames("@"))),
 			),
 			FuncFilterInputRune: func(r rune) (rune, bool) {
 				switch r {
@@ -79,24 +78,39 @@ func GetInput() {
 				continue
 			}
 
+			// select the minecraft server (default one if not specified)
+			srv := servctrl.Default
+			if len(lineSplit) > 2 {
+				if srv = servctrl.ServerByName(lineSplit[2]); srv == nil {
+					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "minecraft server %s not found", lineSplit[2])
+					continue
+				}
+			}
+
 			switch lineSplit[1] {
 
 			case "start":
-				logMsh := servctrl.WarmMS()
+				// a crash loop is reset by a manual start
+				logMsh := srv.StartMS()
 				if logMsh != nil {
 					logMsh.Log(true)
 				}
 			case "freeze":
-				// stop minecraft server forcefully
-				logMsh := servctrl.FreezeMS(true)
-				if logMsh != nil {
-					logMsh.Log(true)
-				}
+				// stop minecraft server forcefully (after the freeze countdown)
+				// [goroutine]
+				go func() {
+					logMsh := srv.FreezeMSCountdown(true)
+					if logMsh != nil {
+						logMsh.Log(true)
+					}
+				}()
 			case "exit":
-				// stop minecraft server forcefully
-				logMsh := servctrl.FreezeMS(true)
-				if logMsh != nil {
-					logMsh.Log(true)
+				// stop minecraft servers forcefully
+				for _, srv := range servctrl.Servers() {
+					logMsh := srv.FreezeMS(true)
+					if logMsh != nil {
+						logMsh.Log(true)
+					}
 				}
 				// terminate msh
 				progmgr.AutoTerminate()
@@ -106,27 +120,49 @@ func GetInput() {
 
 		// taget minecraft server
 		case "mine":
+			// select the minecraft server (default one if not specified with "@<server>")
+			srv := servctrl.Default
+			command := lineSplit[1:]
+			if len(command) > 0 && strings.HasPrefix(command[0], "@") {
+				if srv = servctrl.ServerByName(command[0][1:]); srv == nil {
+					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "minecraft server %s not found", command[0][1:])
+					continue
+				}
+				command = command[1:]
+			}
+
 			// check that there is a command for the target
-			if len(lineSplit) < 2 {
+			if len(command) == 0 {
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify mine command")
 				continue
 			}
 
 			// check if server is online
-			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
-				errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server is not online (try \"msh start\")")
+			if srv.Stats.Status != errco.SERVER_STATUS_ONLINE {
+				errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server %s is not online (try \"msh start %s\")", srv.Name, srv.Name)
 				continue
 			}
 
 			// pass the command to the minecraft server terminal
-			_, logMsh := servctrl.Execute(strings.Join(lineSplit[1:], " "))
+			_, logMsh := srv.Execute(strings.Join(command, " "))
 			if logMsh != nil {
 				logMsh.Log(true)
 			}
 
 		// wrong target
 		default:
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify the target application by adding \"msh\" or \"mine\" before the command.\nExample to get op: mine op <yourname>\nExample to freeze minecraft: msh freeze")
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify the target application by adding \"msh\" or \"mine\" before the command.\nExample to get op: mine op <yourname>\nExample to get op on a routed server: mine @<server> op <yourname>\nExample to freeze minecraft: msh freeze")
+		}
+	}
+}
+
+// serverNames returns a completer function listing the names of the minecraft servers (with prefix)
+func serverNames(prefix string) func(string) []string {
+	return func(string) []string {
+		names := []string{}
+		for _, srv := range servctrl.Servers() {
+			names = append(names, prefix+srv.Name)
 		}
+		return names
 	}
 }
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // struct adapted to config file
 type Configuration struct {
 	Server struct {
@@ -14,6 +16,15 @@ type Configuration struct {
 		StopServer          string `json:"StopServer"`
 		StopServerAllowKill int    `json:"StopServerAllowKill"`
 		ListCommand         string `json:"ListCommand"`
+		Rcon                bool   `json:"Rcon"`            // specify if msh should send commands to the minecraft server using rcon instead of the terminal
+		Attach              bool   `json:"Attach"`          // specify if the minecraft server process is managed by an external supervisor (msh does not start it)
+		AttachStart         string `json:"AttachStart"`     // shell command that starts the attached minecraft server
+		AttachStop          string `json:"AttachStop"`      // shell command that stops the attached minecraft server (empty: StopServer is sent using rcon)
+		AttachPid           string `json:"AttachPid"`       // pid (or pid file) of the attached minecraft server process, used to suspend/kill it
+		AttachCgroup        string `json:"AttachCgroup"`    // cgroup v2 path of the attached minecraft server, used to suspend/kill it (has priority over AttachPid)
+		Driver              string `json:"Driver"`          // driver that runs the minecraft server process ("exec": child process of msh, "docker": docker container)
+		DockerSocket        string `json:"DockerSocket"`    // docker engine api unix socket (empty: /var/run/docker.sock)
+		DockerContainer     string `json:"DockerContainer"` // name or id of the minecraft server docker container
 	} `json:"Commands"`
 	Msh struct {
 		Debug                         int      `json:"Debug"`
@@ -22,20 +33,91 @@ type Configuration struct {
 		MshPortQuery                  int      `json:"MshPortQuery"`
 		EnableQuery                   bool     `json:"EnableQuery"`
 		TimeBeforeStoppingEmptyServer int64    `json:"TimeBeforeStoppingEmptyServer"`
+		FreezeAdaptive                bool     `json:"FreezeAdaptive"`       // specify if msh should choose the time before stopping empty server from the join history
+		FreezeAdaptiveMin             int64    `json:"FreezeAdaptiveMin"`    // min time (seconds) before stopping empty server when FreezeAdaptive is enabled
+		FreezeAdaptiveMax             int64    `json:"FreezeAdaptiveMax"`    // max time (seconds) before stopping empty server when FreezeAdaptive is enabled
+		FreezeWarnings                []int    `json:"FreezeWarnings"`       // seconds before a forced stop at which online players are warned (empty: no warning)
+		FreezeWarningMessage          string   `json:"FreezeWarningMessage"` // warning message sent to online players ({time}: time before the stop, {stay}: StayCommand)
+		FreezeWarningTitle            bool     `json:"FreezeWarningTitle"`   // specify if the warning is also shown as title
+		StayCommand                   string   `json:"StayCommand"`          // chat message that players can send to postpone hibernation (empty: disabled)
+		StayTime                      int64    `json:"StayTime"`             // time (seconds) for which hibernation is postponed by StayCommand
 		ConnectionTimeoutSeconds      int      `json:"ConnectionTimeoutSeconds"`
-		SuspendAllow                  bool     `json:"SuspendAllow"`   // specify if msh should suspend java server process
-		SuspendRefresh                int      `json:"SuspendRefresh"` // specify if msh should refresh java server process suspension and every how many seconds
+		SuspendAllow                  bool     `json:"SuspendAllow"`     // specify if msh should suspend java server process
+		SuspendRefresh                int      `json:"SuspendRefresh"`   // specify if msh should refresh java server process suspension and every how many seconds
+		SuspendCgroup                 bool     `json:"SuspendCgroup"`    // specify if msh should place java server process in its own cgroup v2 and suspend it with the cgroup freezer (linux only)
+		SuspendReclaim                bool     `json:"SuspendReclaim"`   // specify if msh should swap out java server memory after suspending it (linux only)
+		SuspendPrefault               bool     `json:"SuspendPrefault"`  // specify if msh should load back java server memory after resuming it (linux only)
+		CheckpointAllow               bool     `json:"CheckpointAllow"`  // specify if msh should checkpoint java server process to disk with criu instead of stopping it (linux only)
+		CheckpointFolder              string   `json:"CheckpointFolder"` // folder where checkpoints are saved (empty: msh-checkpoints in server folder)
+		CheckpointKeep                int      `json:"CheckpointKeep"`   // number of checkpoints kept on disk
+		CgroupMemoryMax               int      `json:"CgroupMemoryMax"`  // memory limit (MB) of java server cgroup (0: no limit)
+		CgroupCpuMax                  int      `json:"CgroupCpuMax"`     // cpu limit (percent of a cpu core) of java server cgroup (0: no limit)
+		BackupAllow                   bool     `json:"BackupAllow"`      // specify if msh should back up the world when the minecraft server goes offline
+		BackupFormat                  string   `json:"BackupFormat"`     // backup format ("zip", "tar.gz", "tar.zst", "command")
+		BackupCommand                 string   `json:"BackupCommand"`    // shell command executed when BackupFormat is "command" ({worlds}: world folders, {folder}: backup folder)
+		BackupFolder                  string   `json:"BackupFolder"`     // folder where backups are saved (empty: msh-backups in server folder)
+		BackupKeepDaily               int      `json:"BackupKeepDaily"`  // number of days for which the newest backup is kept
+		BackupKeepWeekly              int      `json:"BackupKeepWeekly"` // number of weeks for which the newest backup is kept
+		RestartAllow                  bool     `json:"RestartAllow"`     // specify if msh should restart the minecraft server when it crashes
+		RestartMax                    int      `json:"RestartMax"`       // max restarts after consecutive crashes (then the minecraft server is in a crash loop)
+		RestartBackoff                int      `json:"RestartBackoff"`   // time (seconds) before the first restart (doubled at each consecutive crash)
 		InfoHibernation               string   `json:"InfoHibernation"`
 		InfoStarting                  string   `json:"InfoStarting"`
 		InfoSuspended                 string   `json:"InfoSuspended"`
+		InfoBackup                    string   `json:"InfoBackup"`    // description shown to clients while the world is being backed up
+		InfoCrashLoop                 string   `json:"InfoCrashLoop"` // description shown to clients when the minecraft server is in a crash loop
 		NotifyUpdate                  bool     `json:"NotifyUpdate"`
 		NotifyMessage                 bool     `json:"NotifyMessage"`
-		Whitelist                     []string `json:"Whitelist"`
+		Whitelist                     []string `json:"Whitelist"`     // players/addresses allowed to wake the minecraft server
+		WhitelistJoin                 []string `json:"WhitelistJoin"` // players/addresses allowed to join the running minecraft server
 		WhitelistImport               bool     `json:"WhitelistImport"`
 		ShowResourceUsage             bool     `json:"ShowResourceUsage"`
 		ShowInternetUsage             bool     `json:"ShowInternetUsage"`
-		PassthroughProtocol           bool     `json:"PassthroughProtocol"` // specify if msh should forward unknown protocols to the server
+		PassthroughProtocol           bool     `json:"PassthroughProtocol"`  // specify if msh should forward unknown protocols to the server
+		AcceptProxyProtocol           bool     `json:"AcceptProxyProtocol"`  // specify if msh should read PROXY protocol headers sent by a proxy/load balancer
+		ProxyProtocolTrusted          []string `json:"ProxyProtocolTrusted"` // addresses/CIDR ranges of the proxies allowed to send PROXY protocol headers
+		SendProxyProtocol             bool     `json:"SendProxyProtocol"`    // specify if msh should send a PROXY protocol v2 header to the minecraft server
+		HoldClient                    bool     `json:"HoldClient"`           // specify if msh should keep joining clients connected until the minecraft server is online
+		HoldTransfer                  bool     `json:"HoldTransfer"`         // specify if msh should hold 1.20.5+ clients in configuration phase and transfer them when the minecraft server is online
+		Limbo                         bool     `json:"Limbo"`                // specify if msh should make joining clients wait in its limbo while the minecraft server is starting
+		LimboProtocolMin              int      `json:"LimboProtocolMin"`     // minimum client protocol version allowed in limbo
+		LimboProtocolMax              int      `json:"LimboProtocolMax"`     // maximum client protocol version allowed in limbo (0: no limit)
+		LimboTitle                    string   `json:"LimboTitle"`           // title shown to clients entering limbo
+		LimboActionBar                string   `json:"LimboActionBar"`       // action bar shown to clients in limbo (updated every second)
+		ApiAddress                    string   `json:"ApiAddress"`           // address on which msh serves the http api (empty: api disabled)
+		ApiToken                      string   `json:"ApiToken"`             // token that api requests must send as "Authorization: Bearer <token>"
 	} `json:"Msh"`
+	Routes []struct {
+		Hostnames  []string `json:"Hostnames"`  // server addresses (as typed by players) that are routed to this minecraft server
+		ConfigFile string   `json:"ConfigFile"` // msh config file of the routed minecraft server
+	} `json:"Routes"`
+	Webhooks  []Webhook  `json:"Webhooks"`
+	Schedules []Schedule `json:"Schedules"`
+}
+
+// Webhook is an url to which msh posts a json payload when msh events happen
+type Webhook struct {
+	URL     string            `json:"URL"`
+	Secret  string            `json:"Secret"`  // key used to sign the payload with HMAC-SHA256 (empty: payload is not signed)
+	Events  map[string]string `json:"Events"`  // payload template for each event type ("*" for all events, empty template: default payload)
+	Retries int               `json:"Retries"` // number of retries when delivery fails
+}
+
+// Schedule is a time window in which msh keeps the minecraft server warm or hibernating
+type Schedule struct {
+	Type     string `json:"Type"`     // "warm": keep ms warm during the window, "hibernate": stop ms and forbid waking it during the window
+	Cron     string `json:"Cron"`     // start of the window as cron expression ("minute hour day-of-month month day-of-week", local time)
+	Duration int    `json:"Duration"` // window duration in minutes
+	PreWarm  int    `json:"PreWarm"`  // minutes before the start of a warm window in which ms is warmed
+	Message  string `json:"Message"`  // description shown and kick message sent to clients during a hibernate window
+}
+
+// Checkpoint is the metadata of a minecraft server process checkpoint
+type Checkpoint struct {
+	Date     time.Time `json:"Date"`
+	Pid      uint32    `json:"Pid"`      // pid of checkpointed process (restored with the same pid)
+	Pipes    []string  `json:"Pipes"`    // ids of stdin, stdout, stderr of checkpointed process
+	Restored bool      `json:"Restored"` // specify if checkpoint has already been restored (restoring it again would roll back the world)
 }
 
 // struct for message format txt
@@ -112,6 +194,32 @@ type Api2Res struct {
 	Messages []string `json:"messages"`
 }
 
+// struct for chat component (minecraft json text format)
+type ChatComponent struct {
+	Text          string          `json:"text"`
+	Color         string          `json:"color,omitempty"`
+	Bold          bool            `json:"bold,omitempty"`
+	Italic        bool            `json:"italic,omitempty"`
+	Underlined    bool            `json:"underlined,omitempty"`
+	Strikethrough bool            `json:"strikethrough,omitempty"`
+	Obfuscated    bool            `json:"obfuscated,omitempty"`
+	HoverEvent    *HoverEvent     `json:"hoverEvent,omitempty"`
+	ClickEvent    *ClickEvent     `json:"clickEvent,omitempty"`
+	Extra         []ChatComponent `json:"extra,omitempty"`
+}
+
+// struct for chat component hover event
+type HoverEvent struct {
+	Action   string         `json:"action"`
+	Contents *ChatComponent `json:"contents"`
+}
+
+// struct for chat component click event
+type ClickEvent struct {
+	Action string `json:"action"`
+	Value  string `json:"value"`
+}
+
 // struct for in game raw message
 type GameRawMessage struct {
 	Text  string `json:"text"`
@@ -143,8 +251,35 @@ type MshInstanceV0 struct {
 	CheckSum string `json:"CheckSum"`
 }
 
-// struct for minecraft server whitelist file
+// struct for minecraft server boot history file
+type BootRecord struct {
+	Date    time.Time `json:"Date"`    // time at which the boot ended
+	Seconds float64   `json:"Seconds"` // boot duration
+}
+
+// struct for minecraft server join history file
+type JoinRecord struct {
+	Date  time.Time `json:"Date"`
+	Empty bool      `json:"Empty"` // true: the last player left the server, false: a player joined the server
+}
+
+// struct for minecraft server whitelist file (also used for ops file)
 type MSWhitelist struct {
 	UUID string `json:"uuid"`
 	Name string `json:"name"`
 }
+
+// struct for minecraft server banned players file
+type MSBannedPlayer struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+// struct for minecraft server banned ips file
+type MSBannedIP struct {
+	IP      string `json:"ip"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
@@ -0,0 +1,231 @@
+package opsys
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - docs.kernel.org/admin-guide/cgroup-v2.html
+
+const (
+	cgroupRoot          string        = "/sys/fs/cgroup"    // cgroup v2 mount point
+	cgroupSelf          string        = "/proc/self/cgroup" // cgroup of msh process
+	cgroupFreezeTimeout time.Duration = 5 * time.Second     // max time to wait for cgroup to reach the requested frozen state
+	cgroupCpuPeriod     int           = 100000              // cpu.max period (microseconds)
+	cgroupMshLeaf       string        = "msh"               // leaf cgroup in which msh moves itself to enable controllers for its child cgroups
+	cgroupControllers   string        = "+cpu +memory"      // controllers enabled for msh child cgroups
+)
+
+// cgroupBase is the cgroup in which msh creates the minecraft server cgroups (set by CgroupSetup or on first use)
+var cgroupBase string = ""
+
+// CgroupSetup prepares the cgroup in which msh creates the minecraft server cgroups (linux only).
+//
+// If controllers are needed, it must be called before msh spawns any minecraft server process:
+// controllers can't be enabled while a process (ex: a just started minecraft server) is in msh cgroup.
+// when succeeds returns nil
+func CgroupSetup(controllers bool) *errco.MshLog {
+	if runtime.GOOS != "linux" {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, "cgroups are supported only on linux")
+	}
+
+	logMsh := cgroupLoadBase(controllers)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// CgroupCreate creates a cgroup v2 for the minecraft server as a child of msh cgroup (linux only).
+//
+// memoryMax (MB) and cpuMax (percent of a cpu core) are set as limits of the cgroup if > 0.
+// Limits are applied on a best-effort basis: if the controllers can't be enabled, a warning is logged.
+//
+// when succeeds returns: cgroup path, nil
+func CgroupCreate(name string, memoryMax, cpuMax int) (string, *errco.MshLog) {
+	if runtime.GOOS != "linux" {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, "cgroups are supported only on linux")
+	}
+
+	logMsh := cgroupLoadBase(memoryMax > 0 || cpuMax > 0)
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	cgroupPath := filepath.Join(cgroupBase, name)
+
+	err := os.Mkdir(cgroupPath, 0755)
+	if err != nil && !os.IsExist(err) {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	if memoryMax > 0 {
+		err = os.WriteFile(filepath.Join(cgroupPath, "memory.max"), []byte(strconv.Itoa(memoryMax*1024*1024)), 0644)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CGROUP, "could not set cgroup memory limit: %s", err.Error())
+		}
+	}
+
+	if cpuMax > 0 {
+		err = os.WriteFile(filepath.Join(cgroupPath, "cpu.max"), []byte(fmt.Sprintf("%d %d", cpuMax*cgroupCpuPeriod/100, cgroupCpuPeriod)), 0644)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CGROUP, "could not set cgroup cpu limit: %s", err.Error())
+		}
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "created cgroup (%s)", cgroupPath)
+
+	return cgroupPath, nil
+}
+
+// CgroupAddProc moves a process to a cgroup v2 by path (linux only).
+// Children spawned afterwards by the process are created in the same cgroup.
+// when succeeds returns nil
+func CgroupAddProc(cgroupPath string, pid uint32) *errco.MshLog {
+	err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.procs"), []byte(strconv.FormatUint(uint64(pid), 10)), 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	return nil
+}
+
+// CgroupRemove removes an empty cgroup v2 by path (linux only).
+// when succeeds returns nil
+func CgroupRemove(cgroupPath string) *errco.MshLog {
+	err := os.Remove(cgroupPath)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	return nil
+}
+
+// CgroupFreeze freezes (or thaws) the processes of a cgroup v2 by path (linux only).
+// The frozen state is confirmed through cgroup.events.
+// returns the frozen state of the cgroup (when succeeds: freeze, nil)
+func CgroupFreeze(cgroupPath string, freeze bool) (bool, *errco.MshLog) {
+	value := "0"
+	if freeze {
+		value = "1"
+	}
+
+	err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.freeze"), []byte(value), 0644)
+	if err != nil {
+		return !freeze, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	// wait for all the processes of the cgroup to reach the requested state
+	deadline := time.Now().Add(cgroupFreezeTimeout)
+	for {
+		frozen, logMsh := CgroupFrozen(cgroupPath)
+		if logMsh != nil {
+			return !freeze, logMsh.AddTrace()
+		}
+		if frozen == freeze {
+			break
+		}
+		if time.Now().After(deadline) {
+			return frozen, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, "cgroup did not reach frozen state %t (%s)", freeze, cgroupPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if freeze {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CGROUP FREEZE!")
+	} else {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CGROUP THAW!")
+	}
+
+	return freeze, nil
+}
+
+// CgroupFrozen returns the frozen state of a cgroup v2 by path reported by cgroup.events (linux only)
+func CgroupFrozen(cgroupPath string) (bool, *errco.MshLog) {
+	events, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.events"))
+	if err != nil {
+		return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(events))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "frozen ") {
+			return strings.TrimPrefix(scanner.Text(), "frozen ") == "1", nil
+		}
+	}
+
+	return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, "frozen state not found in cgroup.events (%s)", cgroupPath)
+}
+
+// CgroupKill kills the processes of a cgroup v2 by path (linux 5.14+ only).
+// when succeeds returns nil
+func CgroupKill(cgroupPath string) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "killing cgroup (%s)", cgroupPath)
+
+	err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.kill"), []byte("1"), 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+	}
+
+	return nil
+}
+
+// cgroupLoadBase sets cgroupBase to the cgroup of msh process.
+//
+// If controllers are needed, msh moves itself to a leaf cgroup and enables the controllers for its child cgroups
+// (cgroup v2 "no internal processes" rule: a cgroup with processes can't distribute resources to its children).
+func cgroupLoadBase(controllers bool) *errco.MshLog {
+	if cgroupBase == "" {
+		selfData, err := os.ReadFile(cgroupSelf)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+		}
+
+		// cgroup v2 entry format: "0::/path"
+		for _, line := range strings.Split(string(selfData), "\n") {
+			if strings.HasPrefix(line, "0::") {
+				cgroupBase = filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::"))
+			}
+		}
+		if cgroupBase == "" {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, "cgroup v2 not found (cgroup v1 is not supported)")
+		}
+	}
+
+	if !controllers {
+		return nil
+	}
+
+	subtree, err := os.ReadFile(filepath.Join(cgroupBase, "cgroup.subtree_control"))
+	if err == nil && strings.Contains(string(subtree), "cpu") && strings.Contains(string(subtree), "memory") {
+		return nil
+	}
+
+	leaf := filepath.Join(cgroupBase, cgroupMshLeaf)
+	err = os.Mkdir(leaf, 0755)
+	if err != nil && !os.IsExist(err) {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CGROUP, "could not create msh leaf cgroup: %s", err.Error())
+		return nil
+	}
+	if logMsh := CgroupAddProc(leaf, uint32(os.Getpid())); logMsh != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CGROUP, "could not move msh to leaf cgroup: %s", logMsh.Mex)
+		return nil
+	}
+	err = os.WriteFile(filepath.Join(cgroupBase, "cgroup.subtree_control"), []byte(cgroupControllers), 0644)
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CGROUP, "could not enable cgroup controllers (%s): %s", cgroupControllers, err.Error())
+	}
+
+	return nil
+}
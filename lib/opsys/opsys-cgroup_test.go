@@ -0,0 +1,93 @@
+package opsys
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestCgroupFrozen(t *testing.T) {
+	tests := []struct {
+		events    string
+		expect    bool
+		expectErr bool
+	}{
+		{"populated 1\nfrozen 1\n", true, false},
+		{"populated 1\nfrozen 0\n", false, false},
+		{"populated 0\n", false, true},
+	}
+
+	for _, test := range tests {
+		cgroupPath := t.TempDir()
+		if err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.events"), []byte(test.events), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		frozen, logMsh := CgroupFrozen(cgroupPath)
+		if (logMsh != nil) != test.expectErr {
+			t.Errorf("events %q: unexpected error result (%v)", test.events, logMsh)
+		}
+		if frozen != test.expect {
+			t.Errorf("events %q: frozen is %t (expected %t)", test.events, frozen, test.expect)
+		}
+	}
+}
+
+func TestCgroupFreeze(t *testing.T) {
+	cgroupPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.events"), []byte("populated 1\nfrozen 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	frozen, logMsh := CgroupFreeze(cgroupPath, true)
+	if logMsh != nil || !frozen {
+		t.Errorf("cgroup should be frozen (%v)", logMsh)
+	}
+
+	freeze, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.freeze"))
+	if err != nil || string(freeze) != "1" {
+		t.Errorf("cgroup.freeze should be 1 (%q, %v)", freeze, err)
+	}
+}
+
+func TestCgroupCreateLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are supported only on linux")
+	}
+
+	// fake msh cgroup
+	cgroupBase = t.TempDir()
+	defer func() { cgroupBase = "" }()
+	if err := os.WriteFile(filepath.Join(cgroupBase, "cgroup.subtree_control"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// at msh start (no ms process spawned yet): msh moves to leaf cgroup and enables controllers
+	if logMsh := CgroupSetup(true); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	procs, err := os.ReadFile(filepath.Join(cgroupBase, cgroupMshLeaf, "cgroup.procs"))
+	if err != nil || string(procs) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("msh should be in leaf cgroup (%q, %v)", procs, err)
+	}
+	subtree, err := os.ReadFile(filepath.Join(cgroupBase, "cgroup.subtree_control"))
+	if err != nil || string(subtree) != cgroupControllers {
+		t.Errorf("controllers should be enabled (%q, %v)", subtree, err)
+	}
+
+	// first ms start: limits are applied to ms cgroup
+	cgroupPath, logMsh := CgroupCreate("msh-server-1", 512, 50)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	memoryMax, err := os.ReadFile(filepath.Join(cgroupPath, "memory.max"))
+	if err != nil || string(memoryMax) != "536870912" {
+		t.Errorf("memory.max should be 536870912 (%q, %v)", memoryMax, err)
+	}
+	cpuMax, err := os.ReadFile(filepath.Join(cgroupPath, "cpu.max"))
+	if err != nil || string(cpuMax) != "50000 100000" {
+		t.Errorf("cpu.max should be \"50000 100000\" (%q, %v)", cpuMax, err)
+	}
+}
@@ -0,0 +1,130 @@
+package opsys
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - criu.org/CLI
+// - criu.org/Inheriting_FDs_on_restore
+
+const (
+	criuDumpLog    string = "dump.log"    // criu dump log file (in images folder)
+	criuRestoreLog string = "restore.log" // criu restore log file (in images folder)
+)
+
+// CriuDump checkpoints the process tree of pid into imagesDir using criu (linux only, requires root or CAP_CHECKPOINT_RESTORE).
+// The process tree is killed when the dump is completed.
+//
+// Established tcp connections are dumped (they are restored closed), listening sockets are kept:
+// ms binds its port only at boot, a restored ms without its listening socket could not accept clients anymore.
+// Keeping them is safe as the port of ms must be free for any start: if it's taken when restoring,
+// the restore fails and the cold start (fallback) would fail to bind it as well.
+// when succeeds returns nil
+func CriuDump(pid uint32, imagesDir string) *errco.MshLog {
+	if runtime.GOOS != "linux" {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "criu is supported only on linux")
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "checkpointing proc tree (pid: %d) into %s", pid, imagesDir)
+
+	out, err := exec.Command("criu", "dump",
+		"--tree", strconv.FormatUint(uint64(pid), 10),
+		"--images-dir", imagesDir,
+		"--log-file", criuDumpLog,
+		"--shell-job",
+		"--tcp-established",
+		"--file-locks",
+	).CombinedOutput()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "criu dump failed: %s [%s] (check %s)", err.Error(), strings.TrimSpace(string(out)), filepath.Join(imagesDir, criuDumpLog))
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED PROCESS TREE CHECKPOINT!")
+
+	return nil
+}
+
+// CriuRestore restores the process tree checkpointed in imagesDir using criu (linux only, requires root or CAP_CHECKPOINT_RESTORE).
+// The restored process tree becomes a child of msh (it has the same pid it had when checkpointed).
+// Listening sockets are restored bound to their port, established tcp connections are restored closed.
+//
+// inherit maps the ids of external resources of the process tree (ex: "pipe:[1234]") to the files that replace them.
+// when succeeds returns nil
+func CriuRestore(imagesDir string, inherit map[string]*os.File) *errco.MshLog {
+	if runtime.GOOS != "linux" {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "criu is supported only on linux")
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "restoring proc tree from %s", imagesDir)
+
+	args := []string{"restore",
+		"--images-dir", imagesDir,
+		"--log-file", criuRestoreLog,
+		"--shell-job",
+		"--tcp-close",
+		"--file-locks",
+		"--restore-detached",
+		"--restore-sibling", // restored tree is a child of msh (criu parent)
+	}
+
+	cmd := exec.Command("criu")
+
+	// inherited files are passed to criu starting from fd 3
+	for id, f := range inherit {
+		args = append(args, "--inherit-fd", fmt.Sprintf("fd[%d]:%s", 3+len(cmd.ExtraFiles), id))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+	cmd.Args = append(cmd.Args, args...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "criu restore failed: %s [%s] (check %s)", err.Error(), strings.TrimSpace(string(out)), filepath.Join(imagesDir, criuRestoreLog))
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED PROCESS TREE RESTORE!")
+
+	return nil
+}
+
+// CriuVerify checks that imagesDir contains a completed criu checkpoint.
+// when succeeds returns nil
+func CriuVerify(imagesDir string) *errco.MshLog {
+	if _, err := os.Stat(filepath.Join(imagesDir, "inventory.img")); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "checkpoint images not found: %s", err.Error())
+	}
+
+	dumpLog, err := os.ReadFile(filepath.Join(imagesDir, criuDumpLog))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "checkpoint dump log not found: %s", err.Error())
+	}
+	if !strings.Contains(string(dumpLog), "Dumping finished successfully") {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CRIU, "checkpoint dump did not complete (%s)", imagesDir)
+	}
+
+	return nil
+}
+
+// ProcStdPipes returns the ids of the stdin, stdout, stderr of a process (linux only).
+// Ids have format "pipe:[inode]" (or the file path if not a pipe).
+func ProcStdPipes(pid uint32) ([]string, *errco.MshLog) {
+	pipes := []string{}
+
+	for fd := 0; fd <= 2; fd++ {
+		id, err := os.Readlink(filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10), "fd", strconv.Itoa(fd)))
+		if err != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_NOT_FOUND, err.Error())
+		}
+		pipes = append(pipes, id)
+	}
+
+	return pipes, nil
+}
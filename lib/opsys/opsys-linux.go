@@ -0,0 +1,321 @@
+//go:build linux
+
+package opsys
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"msh/lib/errco"
+)
+
+// iovec is the memory range passed to process_madvise
+type iovec struct {
+	base   uintptr
+	length uintptr
+}
+
+const (
+	// madviseBatch is the max number of memory ranges passed to a single process_madvise call (UIO_MAXIOV is 1024)
+	madviseBatch int = 512
+	// madviseBatchBytes is the max number of bytes advised by a single process_madvise call
+	// (the kernel advises at most MAX_RW_COUNT bytes, ~2 GiB, per call)
+	madviseBatchBytes uintptr = 1 << 30
+)
+
+func memReclaim(cgroupPath string, pgid uint32) (uint64, *errco.MshLog) {
+	// cgroup memory.reclaim requires linux 5.19+ and the memory controller enabled on the cgroup
+	if cgroupPath != "" {
+		reclaimed, logMsh := cgroupReclaim(cgroupPath)
+		if logMsh == nil {
+			return reclaimed, nil
+		}
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "cgroup memory reclaim failed: using process_madvise")
+	}
+
+	pids, logMsh := memPids(cgroupPath, pgid)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	rssBefore := procRss(pids)
+
+	logMsh = madviseAll(pids, unix.MADV_PAGEOUT)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	rssAfter := procRss(pids)
+	if rssAfter >= rssBefore {
+		return 0, nil
+	}
+
+	return rssBefore - rssAfter, nil
+}
+
+func memPrefault(cgroupPath string, pgid uint32) *errco.MshLog {
+	pids, logMsh := memPids(cgroupPath, pgid)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = madviseAll(pids, unix.MADV_WILLNEED)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// cgroupReclaim asks the kernel to reclaim all the memory charged to a cgroup and returns the reclaimed bytes
+func cgroupReclaim(cgroupPath string) (uint64, *errco.MshLog) {
+	before, logMsh := cgroupMemoryCurrent(cgroupPath)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	// EAGAIN: the kernel could not reclaim the full amount (partial reclaim is still measured)
+	err := os.WriteFile(filepath.Join(cgroupPath, "memory.reclaim"), []byte(strconv.FormatUint(before, 10)), 0644)
+	if err != nil && !errors.Is(err, syscall.EAGAIN) {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, err.Error())
+	}
+
+	after, logMsh := cgroupMemoryCurrent(cgroupPath)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+	if after >= before {
+		return 0, nil
+	}
+
+	return before - after, nil
+}
+
+// cgroupMemoryCurrent returns the memory charged to a cgroup
+func cgroupMemoryCurrent(cgroupPath string) (uint64, *errco.MshLog) {
+	data, err := os.ReadFile(filepath.Join(cgroupPath, "memory.current"))
+	if err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, err.Error())
+	}
+
+	current, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONVERSION, err.Error())
+	}
+
+	return current, nil
+}
+
+// memPids returns the pids of the processes in a cgroup or (if cgroupPath is empty) in a process group
+func memPids(cgroupPath string, pgid uint32) ([]int, *errco.MshLog) {
+	pids := []int{}
+
+	if cgroupPath != "" {
+		data, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.procs"))
+		if err != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CGROUP, err.Error())
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(field); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		return pids, nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_LIST, err.Error())
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// the process might have exited in the meantime
+		if pg, err := unix.Getpgid(pid); err == nil && pg == int(pgid) {
+			pids = append(pids, pid)
+		}
+	}
+
+	if len(pids) == 0 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_NOT_FOUND, "no process found in process group %d", pgid)
+	}
+
+	return pids, nil
+}
+
+// procRss returns the sum of resident memory of the processes
+func procRss(pids []int) uint64 {
+	var rss uint64 = 0
+
+	for _, pid := range pids {
+		// statm format: "size resident shared text lib data dt" (in pages)
+		data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "statm"))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			continue
+		}
+		pages, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		rss += pages * uint64(os.Getpagesize())
+	}
+
+	return rss
+}
+
+// madviseAll gives the memory advice to all the memory ranges of the processes using process_madvise (linux 5.10+).
+// An error is returned only if the advice could not be given to any process.
+func madviseAll(pids []int, advice int) *errco.MshLog {
+	var lastLog *errco.MshLog
+	advised := 0
+
+	for _, pid := range pids {
+		logMsh := madvise(pid, advice)
+		if logMsh != nil {
+			lastLog = logMsh
+			continue
+		}
+		advised++
+	}
+
+	if advised == 0 && lastLog != nil {
+		return lastLog.AddTrace()
+	}
+
+	return nil
+}
+
+// madvise gives the memory advice to all the memory ranges of a process using process_madvise
+func madvise(pid int, advice int) *errco.MshLog {
+	ranges, logMsh := procMaps(pid)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "pidfd_open (pid: %d): %s", pid, err.Error())
+	}
+	defer unix.Close(pidfd)
+
+	for _, batch := range madviseBatches(ranges) {
+		// the kernel might advise less bytes than requested: continue from where it stopped
+		for len(batch) > 0 {
+			advised, _, errno := unix.Syscall6(unix.SYS_PROCESS_MADVISE, uintptr(pidfd), uintptr(unsafe.Pointer(&batch[0])), uintptr(len(batch)), uintptr(advice), 0, 0)
+			if errno != 0 {
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "process_madvise (pid: %d): %s", pid, errno.Error())
+			}
+			if advised == 0 {
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "process_madvise (pid: %d): no bytes advised", pid)
+			}
+			batch = madviseSkip(batch, advised)
+		}
+	}
+
+	return nil
+}
+
+// madviseBatches splits the memory ranges in batches of at most madviseBatch ranges and madviseBatchBytes bytes
+// (ranges longer than madviseBatchBytes are split)
+func madviseBatches(ranges []iovec) [][]iovec {
+	batches := [][]iovec{}
+	batch, batchBytes := []iovec{}, uintptr(0)
+
+	for _, r := range ranges {
+		for r.length > 0 {
+			if len(batch) == madviseBatch || batchBytes == madviseBatchBytes {
+				batches = append(batches, batch)
+				batch, batchBytes = []iovec{}, 0
+			}
+
+			chunk := r.length
+			if chunk > madviseBatchBytes-batchBytes {
+				chunk = madviseBatchBytes - batchBytes
+			}
+
+			batch = append(batch, iovec{base: r.base, length: chunk})
+			batchBytes += chunk
+			r.base += chunk
+			r.length -= chunk
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// madviseSkip returns the memory ranges of batch that remain after the first n bytes have been advised
+func madviseSkip(batch []iovec, n uintptr) []iovec {
+	for len(batch) > 0 && n >= batch[0].length {
+		n -= batch[0].length
+		batch = batch[1:]
+	}
+
+	if len(batch) > 0 && n > 0 {
+		return append([]iovec{{base: batch[0].base + n, length: batch[0].length - n}}, batch[1:]...)
+	}
+
+	return batch
+}
+
+// procMaps returns the memory ranges mapped by a process (special kernel mappings excluded)
+func procMaps(pid int) ([]iovec, *errco.MshLog) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_NOT_FOUND, err.Error())
+	}
+	defer f.Close()
+
+	ranges := []iovec{}
+
+	// maps line format: "start-end perms offset dev inode [path]"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if len(fields) > 5 && (fields[5] == "[vvar]" || fields[5] == "[vsyscall]" || fields[5] == "[vdso]") {
+			continue
+		}
+
+		start, end, found := strings.Cut(fields[0], "-")
+		if !found {
+			continue
+		}
+		startAddr, err := strconv.ParseUint(start, 16, 64)
+		if err != nil {
+			continue
+		}
+		endAddr, err := strconv.ParseUint(end, 16, 64)
+		if err != nil {
+			continue
+		}
+
+		ranges = append(ranges, iovec{base: uintptr(startAddr), length: uintptr(endAddr - startAddr)})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "no memory range found (pid: %d)", pid)
+	}
+
+	return ranges, nil
+}
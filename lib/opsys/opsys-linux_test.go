@@ -0,0 +1,76 @@
+//go:build linux
+
+package opsys
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func Test_procMaps(t *testing.T) {
+	ranges, logMsh := procMaps(os.Getpid())
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	for _, r := range ranges {
+		if r.length == 0 {
+			t.Errorf("memory range at %x has zero length", r.base)
+		}
+	}
+
+	if procRss([]int{os.Getpid()}) == 0 {
+		t.Errorf("resident memory of msh should not be zero")
+	}
+}
+
+func Test_memPids(t *testing.T) {
+	pids, logMsh := memPids("", uint32(syscall.Getpgrp()))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	found := false
+	for _, pid := range pids {
+		if pid == os.Getpid() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("msh pid %d not found in its process group %v", os.Getpid(), pids)
+	}
+}
+
+func Test_madviseBatches(t *testing.T) {
+	// a 5 GiB heap mapping and a small mapping
+	ranges := []iovec{{base: 0x10000000, length: 5 << 30}, {base: 0x800000000, length: 4096}}
+
+	batches := madviseBatches(ranges)
+
+	var total uintptr
+	next := ranges[0].base
+	for i, batch := range batches {
+		var batchBytes uintptr
+		for _, r := range batch {
+			batchBytes += r.length
+		}
+		if batchBytes > madviseBatchBytes {
+			t.Errorf("batch %d is %d bytes (max %d)", i, batchBytes, madviseBatchBytes)
+		}
+		if batch[0].base != next && batch[0].base != ranges[1].base {
+			t.Errorf("batch %d starts at %x (expected %x)", i, batch[0].base, next)
+		}
+		next = batch[len(batch)-1].base + batch[len(batch)-1].length
+		total += batchBytes
+	}
+	if total != ranges[0].length+ranges[1].length {
+		t.Errorf("batches cover %d bytes (expected %d)", total, ranges[0].length+ranges[1].length)
+	}
+
+	// kernel stopped in the middle of the second range
+	rest := madviseSkip([]iovec{{base: 0, length: 100}, {base: 1000, length: 100}, {base: 2000, length: 100}}, 150)
+	if len(rest) != 2 || rest[0].base != 1050 || rest[0].length != 50 || rest[1].base != 2000 {
+		t.Errorf("remaining ranges are %v", rest)
+	}
+}
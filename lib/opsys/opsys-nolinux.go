@@ -0,0 +1,15 @@
+//go:build !linux
+
+package opsys
+
+import (
+	"msh/lib/errco"
+)
+
+func memReclaim(cgroupPath string, pgid uint32) (uint64, *errco.MshLog) {
+	return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "memory reclaim is supported only on linux")
+}
+
+func memPrefault(cgroupPath string, pgid uint32) *errco.MshLog {
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MEMORY_RECLAIM, "memory prefault is supported only on linux")
+}
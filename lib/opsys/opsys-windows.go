@@ -5,6 +5,7 @@ package opsys
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"syscall"
 	"unsafe"
 
@@ -44,6 +45,10 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 	return newProcGroupAttr
 }
 
+func newShellCmd(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
 func procTreeSuspend(ppid uint32) *errco.MshLog {
 	// suspendProc suspends a process by pid
 	suspendProc := func(pid uint32) *errco.MshLog {
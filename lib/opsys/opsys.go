@@ -1,6 +1,7 @@
 package opsys
 
 import (
+	"os/exec"
 	"runtime"
 	"syscall"
 
@@ -56,7 +57,40 @@ func ProcTreeKill(ppid uint32) *errco.MshLog {
 	return procTreeKill(ppid)
 }
 
+// MemReclaim asks the kernel to swap out the memory of a suspended process tree (linux only).
+// If cgroupPath is set, the memory of the cgroup is reclaimed, otherwise the memory of the process group pgid.
+// when succeeds returns: reclaimed bytes, nil
+func MemReclaim(cgroupPath string, pgid uint32) (uint64, *errco.MshLog) {
+	reclaimed, logMsh := memReclaim(cgroupPath, pgid)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED MEMORY RECLAIM! (%d MB)", reclaimed/1024/1024)
+
+	return reclaimed, nil
+}
+
+// MemPrefault asks the kernel to load back the swapped out memory of a process tree (linux only).
+// If cgroupPath is set, the processes of the cgroup are prefaulted, otherwise the processes of the process group pgid.
+// when succeeds returns nil
+func MemPrefault(cgroupPath string, pgid uint32) *errco.MshLog {
+	logMsh := memPrefault(cgroupPath, pgid)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED MEMORY PREFAULT!")
+
+	return nil
+}
+
 // FileId returns file id
 func FileId(filePath string) (uint64, error) {
 	return fileId(filePath)
 }
+
+// NewShellCmd returns a cmd that executes the command using the os shell (sh on linux/macos, cmd on windows)
+func NewShellCmd(command string) *exec.Cmd {
+	return newShellCmd(command)
+}
@@ -8,7 +8,6 @@ import (
 
 	"msh/lib/errco"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 )
 
 /*
@@ -36,6 +35,13 @@ type program struct {
 	startTime time.Time      // msh program start time
 	sigExit   chan os.Signal // channel through which OS termination signals are notified
 	mgrActive bool           // indicates if msh manager is running
+
+	// usage since msh start (protected by sgm.m, segment stats are reset when segment ends)
+	usage struct {
+		dur     int // seconds since the first segment tick
+		hibeDur int // seconds with all minecraft servers hibernating
+		playSec int // sum of seconds played by each player
+	}
 }
 
 // MshMgr handles exit signal and updates for msh.
@@ -55,30 +61,34 @@ func MshMgr() {
 		sig := <-msh.sigExit
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "received signal: %s", sig.String())
 
-		// stop the minecraft server forcefully
-		logMsh := servctrl.FreezeMS(true)
-		if logMsh != nil {
-			logMsh.Log(true)
+		// stop the minecraft servers forcefully
+		for _, srv := range servctrl.Servers() {
+			logMsh := srv.FreezeMS(true)
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
 		}
 
 		// send last statistics before exiting
 		go sendApi2Req(updAddr, buildApi2Req(true))
 
-		// wait 1 second to let the server go into stopping mode
+		// wait 1 second to let the servers go into stopping mode
 		time.Sleep(1 * time.Second)
 
-		switch servstats.Stats.Status {
-		case errco.SERVER_STATUS_STOPPING:
-			// if server is correctly stopping, wait for minecraft server to exit
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server terminal to exit (minecraft server is stopping)")
-			servctrl.ServTerm.Wg.Wait()
+		for _, srv := range servctrl.Servers() {
+			switch srv.Stats.Status {
+			case errco.SERVER_STATUS_STOPPING:
+				// if server is correctly stopping, wait for minecraft server to exit
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server terminal to exit (minecraft server %s is stopping)", srv.Name)
+				srv.Term.Wg.Wait()
 
-		case errco.SERVER_STATUS_OFFLINE:
-			// if server is offline, then it's safe to continue
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server terminal already exited (minecraft server is offline)")
+			case errco.SERVER_STATUS_OFFLINE:
+				// if server is offline, then it's safe to continue
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server terminal already exited (minecraft server %s is offline)", srv.Name)
 
-		default:
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stop command does not seem to be stopping minecraft server during forceful shutdown")
+			default:
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stop command does not seem to be stopping minecraft server %s during forceful shutdown", srv.Name)
+			}
 		}
 
 		// exit
@@ -87,6 +97,15 @@ func MshMgr() {
 	}
 }
 
+// Usage returns the msh usage since msh start: duration, hibernation duration and play seconds,
+// and the average cpu/memory usage percent of the msh process tree in the current segment.
+func Usage() (dur, hibeDur, playSec int, usageCpu, usageMem float64) {
+	sgm.m.Lock()
+	defer sgm.m.Unlock()
+
+	return msh.usage.dur, msh.usage.hibeDur, msh.usage.playSec, sgm.stats.usageCpu, sgm.stats.usageMem
+}
+
 // AutoTerminate induces correct msh termination via msh manager
 func AutoTerminate() {
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "issuing msh termination")
@@ -13,7 +13,6 @@ import (
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 
 	"github.com/shirou/gopsutil/mem"
 )
@@ -93,16 +92,29 @@ func sgmMgr() {
 
 			// increment segment duration counter
 			sgm.stats.dur += 1
+			msh.usage.dur += 1
 
-			// increment hibernation duration counter if ms is not warm/interactable
-			logMsh := servctrl.CheckMSWarm()
-			if logMsh != nil {
+			// increment hibernation duration counter if all ms are not warm/interactable
+			hibernating := true
+			for _, srv := range servctrl.Servers() {
+				if srv.CheckMSWarm() == nil {
+					hibernating = false
+				}
+
+				// increment play seconds sum
+				sgm.stats.playSec += srv.Stats.ConnCount
+				msh.usage.playSec += srv.Stats.ConnCount
+
+				// increment seconds spent in the current ms status
+				srv.Stats.M.Lock()
+				srv.Stats.StatusSeconds[srv.Stats.StatusName()] += 1
+				srv.Stats.M.Unlock()
+			}
+			if hibernating {
 				sgm.stats.hibeDur += 1
+				msh.usage.hibeDur += 1
 			}
 
-			// increment play seconds sum
-			sgm.stats.playSec += servstats.Stats.ConnCount
-
 			// update segment average cpu/memory usage
 			mshTreeCpu, mshTreeMem := getMshTreeStats()
 			sgm.stats.usageCpu = (sgm.stats.usageCpu*float64(sgm.stats.dur-1) + float64(mshTreeCpu)) / float64(sgm.stats.dur) // sgm.stats.seconds-1 because the average is relative to 1 sec ago
@@ -125,20 +137,22 @@ func sgmMgr() {
 		// send a notification in game chat for players to see.
 		// (should not send notification in console)
 		case <-sgm.push.tk.C:
-			if sgm.push.verCheck != "" && servstats.Stats.ConnCount > 0 {
-				logMsh := servctrl.TellRaw("manager", sgm.push.verCheck, "sgmMgr")
-				if logMsh != nil {
-					logMsh.Log(true)
-				}
-			}
-
-			if len(sgm.push.messages) != 0 && servstats.Stats.ConnCount > 0 {
-				for _, m := range sgm.push.messages {
-					logMsh := servctrl.TellRaw("message", m, "sgmMgr")
+			for _, srv := range servctrl.Servers() {
+				if sgm.push.verCheck != "" && srv.Stats.ConnCount > 0 {
+					logMsh := srv.TellRaw("manager", sgm.push.verCheck, "sgmMgr")
 					if logMsh != nil {
 						logMsh.Log(true)
 					}
 				}
+
+				if len(sgm.push.messages) != 0 && srv.Stats.ConnCount > 0 {
+					for _, m := range sgm.push.messages {
+						logMsh := srv.TellRaw("message", m, "sgmMgr")
+						if logMsh != nil {
+							logMsh.Log(true)
+						}
+					}
+				}
 			}
 
 		// send request when segment ends
@@ -0,0 +1,273 @@
+package servctrl
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// attached ms (Commands.Attach) is supervised by an external process manager (systemd, docker, ...):
+// msh does not own ms process, ms status is detected by probing ms and ms is started/stopped by hooks.
+
+const (
+	attachProbeInterval time.Duration = 2 * time.Second // time between two probes of attached ms
+	attachProbeTimeout  time.Duration = 1 * time.Second // timeout of a probe of attached ms
+)
+
+// attachStart executes the start hook of attached ms and sets ms status as starting.
+// ms status is set as online by attachWatch when ms responds.
+func (s *Server) attachStart() *errco.MshLog {
+	if s.Config.Commands.AttachStart == "" {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_ATTACH_HOOK, "start hook of attached minecraft server not set (Commands.AttachStart)")
+	}
+
+	logMsh := s.attachHook(s.Config.Commands.AttachStart)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	s.setStarting()
+
+	return nil
+}
+
+// attachStop executes the stop hook of attached ms and sets ms status as stopping.
+// If the stop hook is not set, StopServer command is executed (using rcon).
+func (s *Server) attachStop() *errco.MshLog {
+	var logMsh *errco.MshLog
+
+	if s.Config.Commands.AttachStop == "" {
+		_, logMsh = s.Execute(s.Config.Commands.StopServer)
+	} else {
+		logMsh = s.attachHook(s.Config.Commands.AttachStop)
+	}
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// attachWatch might have already detected ms exit (stop hook waits for ms to stop)
+	if s.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		s.setStopping()
+	}
+
+	return nil
+}
+
+// attachHook executes a hook command using the os shell and logs its output
+func (s *Server) attachHook(command string) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms hook: %s%s%s", errco.COLOR_CYAN, command, errco.COLOR_RESET)
+
+	cmd := opsys.NewShellCmd(command)
+	if _, err := os.Stat(s.Config.Server.Folder); err == nil {
+		cmd.Dir = s.Config.Server.Folder
+	}
+
+	out, err := cmd.CombinedOutput()
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, "[hook] %s", line)
+		}
+	}
+
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_ATTACH_HOOK, "hook \"%s\" failed: %s", command, err.Error())
+	}
+
+	return nil
+}
+
+// attachWatch probes attached ms and updates ms status accordingly:
+// an attached ms might be started/stopped by its supervisor without msh knowing it.
+//
+// [goroutine]
+func (s *Server) attachWatch() {
+	var stopSuspendRefresherC chan bool
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "attached ms watcher is starting (%s)", s.Name)
+
+	ticker := time.NewTicker(attachProbeInterval)
+
+	for range ticker.C {
+		// suspended ms process can't respond to probes
+		if s.Stats.Suspended {
+			continue
+		}
+
+		reachable := s.attachProbe()
+
+		switch {
+		case reachable && s.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+			// ms has been started by its supervisor
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "attached minecraft server started externally")
+			s.attachFound()
+
+		case reachable && s.Stats.Status == errco.SERVER_STATUS_STARTING:
+			s.setOnline()
+
+		case !reachable && (s.Stats.Status == errco.SERVER_STATUS_ONLINE || s.Stats.Status == errco.SERVER_STATUS_STOPPING):
+			s.setOffline()
+		}
+
+		// start/stop suspension refresher following ms terminal state
+		switch {
+		case s.Term.IsActive && stopSuspendRefresherC == nil:
+			stopSuspendRefresherC = make(chan bool, 1)
+			go s.suspendRefresher(stopSuspendRefresherC)
+		case !s.Term.IsActive && stopSuspendRefresherC != nil:
+			stopSuspendRefresherC <- true
+			stopSuspendRefresherC = nil
+		}
+	}
+}
+
+// attachFound sets the attached ms, found already running, as online.
+// (its boot duration is unknown: it's not recorded as boot duration)
+func (s *Server) attachFound() {
+	s.setStarting()
+	s.Stats.Status = errco.SERVER_STATUS_ONLINE
+	s.setOnline()
+}
+
+// attachProbe returns true if attached ms accepts connections.
+// The rcon port is probed if Commands.Rcon is enabled (rcon starts when ms is done loading), otherwise the server port.
+func (s *Server) attachProbe() bool {
+	port := s.Config.ServPort
+	if s.Config.Commands.Rcon {
+		if rconPort, logMsh := s.Config.ParsePropertiesInt("rcon.port"); logMsh == nil {
+			port = rconPort
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Config.ServHost, strconv.Itoa(port)), attachProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+// attachPid returns the pid of attached ms process.
+// Commands.AttachPid can be a pid or the path of a pid file.
+func (s *Server) attachPid() (uint32, *errco.MshLog) {
+	pidStr := strings.TrimSpace(s.Config.Commands.AttachPid)
+	if pidStr == "" {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_ATTACH_PROCESS, "pid of attached minecraft server not set (Commands.AttachPid)")
+	}
+
+	if _, err := strconv.ParseUint(pidStr, 10, 32); err != nil {
+		pidData, err := os.ReadFile(pidStr)
+		if err != nil {
+			return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_ATTACH_PROCESS, "could not read pid file: %s", err.Error())
+		}
+		pidStr = strings.TrimSpace(string(pidData))
+	}
+
+	pid, err := strconv.ParseUint(pidStr, 10, 32)
+	if err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONVERSION, err.Error())
+	}
+
+	return uint32(pid), nil
+}
+
+// procSuspend suspends ms process using the server driver (attached ms: by cgroup or pid).
+// when succeeds returns: true, nil
+func (s *Server) procSuspend() (bool, *errco.MshLog) {
+	if !s.Config.Commands.Attach {
+		return s.Term.driver.suspend()
+	}
+
+	if s.Config.Commands.AttachCgroup != "" {
+		return opsys.CgroupFreeze(s.Config.Commands.AttachCgroup, true)
+	}
+
+	pid, logMsh := s.attachPid()
+	if logMsh != nil {
+		return false, logMsh.AddTrace()
+	}
+
+	return opsys.ProcTreeSuspend(pid)
+}
+
+// procResume resumes ms process using the server driver (attached ms: by cgroup or pid).
+// when succeeds returns: false, nil
+func (s *Server) procResume() (bool, *errco.MshLog) {
+	if !s.Config.Commands.Attach {
+		return s.Term.driver.resume()
+	}
+
+	if s.Config.Commands.AttachCgroup != "" {
+		return opsys.CgroupFreeze(s.Config.Commands.AttachCgroup, false)
+	}
+
+	pid, logMsh := s.attachPid()
+	if logMsh != nil {
+		return true, logMsh.AddTrace()
+	}
+
+	return opsys.ProcTreeResume(pid)
+}
+
+// procKill kills ms process using the server driver (attached ms: by cgroup or pid).
+// when succeeds returns nil
+func (s *Server) procKill() *errco.MshLog {
+	if !s.Config.Commands.Attach {
+		return s.Term.driver.kill()
+	}
+
+	if s.Config.Commands.AttachCgroup != "" {
+		return opsys.CgroupKill(s.Config.Commands.AttachCgroup)
+	}
+
+	pid, logMsh := s.attachPid()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return opsys.ProcTreeKill(pid)
+}
+
+// procReclaim swaps out the memory of suspended ms using the server driver (attached ms: by cgroup or pid).
+// when succeeds returns: reclaimed bytes, nil
+func (s *Server) procReclaim() (uint64, *errco.MshLog) {
+	if !s.Config.Commands.Attach {
+		return s.Term.driver.reclaim()
+	}
+
+	if s.Config.Commands.AttachCgroup != "" {
+		return opsys.MemReclaim(s.Config.Commands.AttachCgroup, 0)
+	}
+
+	pid, logMsh := s.attachPid()
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	return opsys.MemReclaim("", pid)
+}
+
+// procPrefault loads back the swapped out memory of ms using the server driver (attached ms: by cgroup or pid).
+// when succeeds returns nil
+func (s *Server) procPrefault() *errco.MshLog {
+	if !s.Config.Commands.Attach {
+		return s.Term.driver.prefault()
+	}
+
+	if s.Config.Commands.AttachCgroup != "" {
+		return opsys.MemPrefault(s.Config.Commands.AttachCgroup, 0)
+	}
+
+	pid, logMsh := s.attachPid()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return opsys.MemPrefault("", pid)
+}
@@ -0,0 +1,83 @@
+package servctrl
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+func Test_attachPid(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+
+	pidFile := filepath.Join(t.TempDir(), "server.pid")
+	if err := os.WriteFile(pidFile, []byte("4321\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		attachPid string
+		expect    uint32
+		expectErr bool
+	}{
+		{"1234", 1234, false},
+		{" 1234 ", 1234, false},
+		{pidFile, 4321, false},
+		{"", 0, true},
+		{filepath.Join(t.TempDir(), "missing.pid"), 0, true},
+	}
+
+	for _, test := range tests {
+		s.Config.Commands.AttachPid = test.attachPid
+		pid, logMsh := s.attachPid()
+		if (logMsh != nil) != test.expectErr {
+			t.Errorf("attach pid %q: unexpected error result (%v)", test.attachPid, logMsh)
+			continue
+		}
+		if pid != test.expect {
+			t.Errorf("attach pid %q is %d (expected %d)", test.attachPid, pid, test.expect)
+		}
+	}
+}
+
+func Test_attachProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.ServHost = "127.0.0.1"
+	s.Config.ServPort = l.Addr().(*net.TCPAddr).Port
+
+	if !s.attachProbe() {
+		t.Errorf("listening server should be reachable")
+	}
+
+	l.Close()
+
+	if s.attachProbe() {
+		t.Errorf("closed server should not be reachable")
+	}
+}
+
+func Test_attachFound(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Server.Folder = t.TempDir()
+	s.Config.ServHost = "127.0.0.1"
+	s.Config.ServPort = 1
+
+	s.attachFound()
+	defer s.Stats.FreezeTimer.Stop()
+
+	if s.Stats.Status != errco.SERVER_STATUS_ONLINE {
+		t.Errorf("attached minecraft server found running should be online")
+	}
+	if len(s.bootHistory) != 0 || len(s.Stats.BootDurations) != 0 {
+		t.Errorf("attached minecraft server found running should not record a boot (%v)", s.Stats.BootDurations)
+	}
+}
@@ -0,0 +1,356 @@
+package servctrl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/opsys"
+)
+
+// backup formats
+const (
+	BACKUP_ZIP     string = "zip"     // zip archive
+	BACKUP_TAR_GZ  string = "tar.gz"  // gzip compressed tar archive
+	BACKUP_TAR_ZST string = "tar.zst" // zstd compressed tar archive (requires zstd installed)
+	BACKUP_COMMAND string = "command" // Msh.BackupCommand is executed (retention is managed by the command)
+)
+
+const (
+	// backupFolderName is the default folder (in minecraft server folder) where backups are saved
+	backupFolderName string = "msh-backups"
+
+	// backupPrefix and backupDateFormat compose the name of backup archives (ex: "msh-backup-20240101-153000.zip")
+	backupPrefix     string = "msh-backup-"
+	backupDateFormat string = "20060102-150405"
+)
+
+// BackingUp returns true if a world backup is in progress (ms can't be woken)
+func (s *Server) BackingUp() bool {
+	return s.backingUp.Load()
+}
+
+// backupWorld backs up the world folders of ms and removes the old backups according to retention.
+// Should be called when ms is offline and s.backingUp is set.
+func (s *Server) backupWorld() *errco.MshLog {
+	startTime := time.Now()
+
+	worlds, logMsh := s.worldFolders()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER WORLD IS BEING BACKED UP! %v (%s)", worlds, s.Name)
+
+	folder := s.backupFolder()
+
+	if s.Config.Msh.BackupFormat == BACKUP_COMMAND {
+		logMsh = s.backupCommand(worlds, folder)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "world backup command completed in %s (%s)", time.Since(startTime).Round(time.Millisecond), s.Name)
+		events.Publish(events.BACKED_UP, s.Name, map[string]interface{}{"seconds": time.Since(startTime).Seconds()})
+
+		return nil
+	}
+
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+	}
+
+	path := filepath.Join(folder, backupPrefix+startTime.Format(backupDateFormat)+"."+s.Config.Msh.BackupFormat)
+
+	// archive is written to a temporary file so that an interrupted backup is not mistaken for a complete one
+	logMsh = writeBackup(path+".tmp", s.Config.Server.Folder, worlds, s.Config.Msh.BackupFormat)
+	if logMsh != nil {
+		os.Remove(path + ".tmp")
+		return logMsh.AddTrace()
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+	}
+
+	var size int64 = 0
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "world backup completed: %s (%.1f MB in %s)", path, float64(size)/1024/1024, time.Since(startTime).Round(time.Millisecond))
+	events.Publish(events.BACKED_UP, s.Name, map[string]interface{}{"file": path, "bytes": size, "seconds": time.Since(startTime).Seconds()})
+
+	pruneBackups(folder, s.Config.Msh.BackupKeepDaily, s.Config.Msh.BackupKeepWeekly)
+
+	return nil
+}
+
+// backupFolder returns the folder where backups of ms are saved
+func (s *Server) backupFolder() string {
+	if s.Config.Msh.BackupFolder != "" {
+		return s.Config.Msh.BackupFolder
+	}
+
+	return filepath.Join(s.Config.Server.Folder, backupFolderName)
+}
+
+// worldFolders returns the world folders of ms (relative to server folder) found from server.properties level-name.
+// Nether and end folders of bukkit based servers are included if they exist.
+func (s *Server) worldFolders() ([]string, *errco.MshLog) {
+	levelName, logMsh := s.Config.ParsePropertiesString("level-name")
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	worlds := []string{}
+	for _, w := range []string{levelName, levelName + "_nether", levelName + "_the_end"} {
+		if info, err := os.Stat(filepath.Join(s.Config.Server.Folder, w)); err == nil && info.IsDir() {
+			worlds = append(worlds, w)
+		}
+	}
+
+	if len(worlds) == 0 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, "world folder not found: %s", filepath.Join(s.Config.Server.Folder, levelName))
+	}
+
+	return worlds, nil
+}
+
+// backupCommand executes Msh.BackupCommand in server folder.
+// Placeholders: {worlds} (world folders separated by space), {folder} (backup folder).
+func (s *Server) backupCommand(worlds []string, folder string) *errco.MshLog {
+	command := strings.NewReplacer("{worlds}", strings.Join(worlds, " "), "{folder}", folder).Replace(s.Config.Msh.BackupCommand)
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "backup command: %s%s%s", errco.COLOR_CYAN, command, errco.COLOR_RESET)
+
+	cmd := opsys.NewShellCmd(command)
+	cmd.Dir = s.Config.Server.Folder
+
+	out, err := cmd.CombinedOutput()
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, "[backup] %s", line)
+		}
+	}
+
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, "backup command failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+// writeBackup archives the folders (relative to base) to path in the specified format
+func writeBackup(path, base string, folders []string, format string) *errco.MshLog {
+	f, err := os.Create(path)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+	}
+	defer f.Close()
+
+	switch format {
+	case BACKUP_ZIP:
+		zw := zip.NewWriter(f)
+		logMsh := walkBackup(base, folders, func(name string, info fs.FileInfo, r io.Reader) error {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			header.Method = zip.Deflate
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			return err
+		})
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if err := zw.Close(); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+		}
+
+	case BACKUP_TAR_GZ:
+		gw := gzip.NewWriter(f)
+		logMsh := writeTar(gw, base, folders)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if err := gw.Close(); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+		}
+
+	case BACKUP_TAR_ZST:
+		// tar stream is compressed by zstd (multithreaded)
+		cmd := exec.Command("zstd", "-q", "-T0", "-c")
+		cmd.Stdout = f
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+		}
+		if err := cmd.Start(); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, "zstd could not be started: %s", err.Error())
+		}
+		logMsh := writeTar(stdin, base, folders)
+		stdin.Close()
+		if err := cmd.Wait(); err != nil && logMsh == nil {
+			logMsh = errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, "zstd failed: %s", err.Error())
+		}
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+	default:
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, "backup format \"%s\" is not supported", format)
+	}
+
+	if err := f.Sync(); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+	}
+
+	return nil
+}
+
+// writeTar writes a tar archive of the folders (relative to base) to w
+func writeTar(w io.Writer, base string, folders []string) *errco.MshLog {
+	tw := tar.NewWriter(w)
+
+	logMsh := walkBackup(base, folders, func(name string, info fs.FileInfo, r io.Reader) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	if err := tw.Close(); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+	}
+
+	return nil
+}
+
+// walkBackup calls add for each regular file in the folders (relative to base).
+// name is the slash separated path relative to base.
+func walkBackup(base string, folders []string, add func(name string, info fs.FileInfo, r io.Reader) error) *errco.MshLog {
+	for _, folder := range folders {
+		err := filepath.WalkDir(filepath.Join(base, folder), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return add(filepath.ToSlash(rel), info, f)
+		})
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKUP, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// pruneBackups removes the backups that are not kept by retention:
+// the newest backup of each of the last keepDaily days and of each of the last keepWeekly weeks.
+// The newest backup is always kept.
+func pruneBackups(folder string, keepDaily, keepWeekly int) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_BACKUP, "can't read backup folder: %s", err.Error())
+		return
+	}
+
+	type backup struct {
+		name string
+		date time.Time
+	}
+	backups := []backup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), backupPrefix) || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		dateStr := strings.TrimPrefix(entry.Name(), backupPrefix)
+		if len(dateStr) < len(backupDateFormat) {
+			continue
+		}
+		date, err := time.ParseInLocation(backupDateFormat, dateStr[:len(backupDateFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: entry.Name(), date: date})
+	}
+
+	// newest first
+	sort.Slice(backups, func(i, j int) bool { return backups[i].date.After(backups[j].date) })
+
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+
+	for i, b := range backups {
+		keep := i == 0
+
+		day := b.date.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep = true
+		}
+
+		year, week := b.date.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep = true
+		}
+
+		if keep {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(folder, b.name)); err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_BACKUP, "can't remove backup: %s", err.Error())
+		} else {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "removed old backup (%s)", b.name)
+		}
+	}
+}
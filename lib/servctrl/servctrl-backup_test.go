@@ -0,0 +1,112 @@
+package servctrl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_writeBackup(t *testing.T) {
+	base := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(base, "world", "region"), 0755)
+	_ = os.MkdirAll(filepath.Join(base, "world_nether"), 0755)
+	_ = os.WriteFile(filepath.Join(base, "world", "level.dat"), []byte("level"), 0644)
+	_ = os.WriteFile(filepath.Join(base, "world", "region", "r.0.0.mca"), []byte("region"), 0644)
+	_ = os.WriteFile(filepath.Join(base, "world_nether", "level.dat"), []byte("nether"), 0644)
+	_ = os.WriteFile(filepath.Join(base, "server.jar"), []byte("jar"), 0644)
+
+	expect := []string{"world/level.dat", "world/region/r.0.0.mca", "world_nether/level.dat"}
+
+	// zip
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	if logMsh := writeBackup(path, base, []string{"world", "world_nether"}, BACKUP_ZIP); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	zr.Close()
+	sort.Strings(names)
+	if len(names) != len(expect) || names[0] != expect[0] || names[1] != expect[1] || names[2] != expect[2] {
+		t.Errorf("zip backup contains %v (expected %v)", names, expect)
+	}
+
+	// tar.gz
+	path = filepath.Join(t.TempDir(), "backup.tar.gz")
+	if logMsh := writeBackup(path, base, []string{"world", "world_nether"}, BACKUP_TAR_GZ); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	count := 0
+	for {
+		if _, err := tr.Next(); err != nil {
+			break
+		}
+		count++
+	}
+	if count != len(expect) {
+		t.Errorf("tar.gz backup contains %d files (expected %d)", count, len(expect))
+	}
+
+	if logMsh := writeBackup(filepath.Join(t.TempDir(), "backup.rar"), base, []string{"world"}, "rar"); logMsh == nil {
+		t.Errorf("backup format rar should not be supported")
+	}
+}
+
+func Test_pruneBackups(t *testing.T) {
+	folder := t.TempDir()
+
+	// two backups a day for 30 days (2024-01-01 is a monday)
+	start := time.Date(2024, time.January, 1, 8, 0, 0, 0, time.Local)
+	for d := 0; d < 30; d++ {
+		for _, h := range []int{0, 10} {
+			date := start.AddDate(0, 0, d).Add(time.Duration(h) * time.Hour)
+			_ = os.WriteFile(filepath.Join(folder, backupPrefix+date.Format(backupDateFormat)+".zip"), []byte{}, 0644)
+		}
+	}
+	_ = os.WriteFile(filepath.Join(folder, "other.zip"), []byte{}, 0644)
+
+	pruneBackups(folder, 3, 2)
+
+	entries, _ := os.ReadDir(folder)
+	kept := []string{}
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+
+	// newest backup of 2024-01-30, 01-29, 01-28 (daily) and of the week of 01-22 (weekly, 01-28 is sunday)
+	expect := []string{
+		backupPrefix + "20240128-180000.zip",
+		backupPrefix + "20240129-180000.zip",
+		backupPrefix + "20240130-180000.zip",
+		"other.zip",
+	}
+	if len(kept) != len(expect) {
+		t.Fatalf("kept backups are %v (expected %v)", kept, expect)
+	}
+	for i := range expect {
+		if kept[i] != expect[i] {
+			t.Errorf("kept backups are %v (expected %v)", kept, expect)
+			break
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+const (
+	// bootHistoryFileName is the file (in minecraft server folder) where the durations of previous boots are stored
+	bootHistoryFileName string = "msh-boot-history.json"
+
+	// bootHistoryLen is the number of boots kept in history
+	bootHistoryLen int = 20
+
+	// bootEstimateLen is the number of most recent boots used to estimate the boot duration
+	bootEstimateLen int = 5
+)
+
+// loadBootHistory loads the durations of previous boots from file and updates the boot estimate.
+// If the file does not exist the boot history is left empty.
+func (s *Server) loadBootHistory() {
+	data, err := os.ReadFile(filepath.Join(s.Config.Server.Folder, bootHistoryFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_BOOT_HISTORY, "can't read boot history file: %s", err.Error())
+		}
+		return
+	}
+
+	var history []model.BootRecord
+	if err = json.Unmarshal(data, &history); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_BOOT_HISTORY, "boot history file format error: %s", err.Error())
+		return
+	}
+
+	s.bootHistory = history
+	s.Stats.BootEstimate = estimateBoot(history)
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "boot history loaded: %d boots, estimated boot duration %s (%s)", len(history), s.Stats.BootEstimate.String(), s.Name)
+}
+
+// recordBoot adds the duration of a boot to history, updates the boot estimate and saves the history to file
+func (s *Server) recordBoot(d time.Duration) *errco.MshLog {
+	s.bootHistory = append(s.bootHistory, model.BootRecord{Date: time.Now(), Seconds: d.Seconds()})
+	if len(s.bootHistory) > bootHistoryLen {
+		s.bootHistory = s.bootHistory[len(s.bootHistory)-bootHistoryLen:]
+	}
+
+	s.Stats.BootEstimate = estimateBoot(s.bootHistory)
+
+	s.Stats.M.Lock()
+	s.Stats.BootDurations = append(s.Stats.BootDurations, d.Seconds())
+	s.Stats.M.Unlock()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server booted in %s, estimated boot duration %s (%s)", d.Round(time.Second).String(), s.Stats.BootEstimate.String(), s.Name)
+
+	data, err := json.MarshalIndent(s.bootHistory, "", "  ")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(s.Config.Server.Folder, bootHistoryFileName), data, 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_BOOT_HISTORY, "can't write boot history file: %s", err.Error())
+	}
+
+	return nil
+}
+
+// BootETA returns the estimated time needed by the minecraft server to be online.
+// If ms is starting the elapsed boot time is subtracted (a boot taking longer than expected returns 0).
+// If no boot was recorded returns -1.
+func (s *Server) BootETA() time.Duration {
+	if s.Stats.BootEstimate == 0 {
+		return -1
+	}
+
+	switch s.Stats.Status {
+	case errco.SERVER_STATUS_ONLINE, errco.SERVER_STATUS_SUSPENDED:
+		return 0
+
+	case errco.SERVER_STATUS_STARTING:
+		if eta := s.Stats.BootEstimate - time.Since(s.Term.startTime); eta > 0 {
+			return eta
+		}
+		return 0
+
+	default:
+		return s.Stats.BootEstimate
+	}
+}
+
+// estimateBoot returns the boot duration estimate: the median of the most recent boots (0 if history is empty).
+// The median is used so that an occasional slow boot (world upgrade, first start) does not skew the estimate.
+func estimateBoot(history []model.BootRecord) time.Duration {
+	if len(history) > bootEstimateLen {
+		history = history[len(history)-bootEstimateLen:]
+	}
+	if len(history) == 0 {
+		return 0
+	}
+
+	secs := []float64{}
+	for _, b := range history {
+		secs = append(secs, b.Seconds)
+	}
+	sort.Float64s(secs)
+
+	median := secs[len(secs)/2]
+	if len(secs)%2 == 0 {
+		median = (secs[len(secs)/2-1] + secs[len(secs)/2]) / 2
+	}
+
+	return time.Duration(median * float64(time.Second)).Round(time.Second)
+}
@@ -0,0 +1,67 @@
+package servctrl
+
+import (
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servstats"
+)
+
+func Test_estimateBoot(t *testing.T) {
+	boots := func(secs ...float64) []model.BootRecord {
+		history := []model.BootRecord{}
+		for _, s := range secs {
+			history = append(history, model.BootRecord{Date: time.Now(), Seconds: s})
+		}
+		return history
+	}
+
+	tests := []struct {
+		history []model.BootRecord
+		expect  time.Duration
+	}{
+		{boots(), 0},
+		{boots(40), 40 * time.Second},
+		{boots(40, 50), 45 * time.Second},
+		{boots(40, 45, 300), 45 * time.Second},                  // slow boot does not skew the estimate
+		{boots(300, 300, 40, 41, 42, 43, 44), 42 * time.Second}, // only recent boots are used
+	}
+
+	for _, test := range tests {
+		if e := estimateBoot(test.history); e != test.expect {
+			t.Errorf("boot estimate is %s (expected %s)", e, test.expect)
+		}
+	}
+}
+
+func Test_recordBoot(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Server.Folder = t.TempDir()
+
+	if s.BootETA() != -1 {
+		t.Errorf("boot eta should be unknown before first boot")
+	}
+
+	for i := 0; i < bootHistoryLen+5; i++ {
+		if logMsh := s.recordBoot(30 * time.Second); logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+	}
+
+	// history is trimmed and persisted
+	loaded := &Server{Name: "test", Config: s.Config, Stats: servstats.NewStats()}
+	loaded.loadBootHistory()
+	if len(loaded.bootHistory) != bootHistoryLen || loaded.Stats.BootEstimate != 30*time.Second {
+		t.Errorf("loaded boot history has %d boots and estimate %s", len(loaded.bootHistory), loaded.Stats.BootEstimate)
+	}
+
+	// eta while starting
+	s.Stats.Status = errco.SERVER_STATUS_STARTING
+	s.Term.startTime = time.Now().Add(-10 * time.Second)
+	if eta := s.BootETA(); eta < 19*time.Second || eta > 20*time.Second {
+		t.Errorf("boot eta while starting is %s (expected ~20s)", eta)
+	}
+}
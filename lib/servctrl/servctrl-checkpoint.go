@@ -0,0 +1,181 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/model"
+	"msh/lib/opsys"
+)
+
+const (
+	// checkpointFolderName is the default folder (in minecraft server folder) where checkpoints are saved
+	checkpointFolderName string = "msh-checkpoints"
+
+	// checkpointMetaFileName is the file (in checkpoint folder) where the checkpoint metadata is stored
+	checkpointMetaFileName string = "msh-checkpoint.json"
+)
+
+// checkpointMS saves world, checkpoints ms process to disk and lets ms terminal exit.
+// On the next warm, ms process is restored from the checkpoint.
+//
+// Should be called only when s.Stats.Status == ONLINE.
+// If the checkpoint fails, ms status is set back to online.
+func (s *Server) checkpointMS() *errco.MshLog {
+	// save world so that a cold start is consistent if the restore fails
+	_, logMsh := s.Execute("save-all flush")
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	dir, logMsh := newCheckpointDir(s.Config)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// clients can't join while ms is being checkpointed
+	s.setStopping()
+
+	// established connections to ms are not restored: close them before the dump
+	s.rcon.close()
+
+	logMsh = s.Term.driver.checkpoint(dir)
+	if logMsh != nil {
+		os.RemoveAll(dir)
+		s.Stats.Status = errco.SERVER_STATUS_ONLINE
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS CHECKPOINTED! (%s)", s.Name)
+	events.Publish(events.CHECKPOINTED, s.Name, map[string]interface{}{"folder": dir})
+
+	pruneCheckpoints(s.Config)
+
+	return nil
+}
+
+// checkpointFolder returns the folder where checkpoints of ms are saved
+func checkpointFolder(c *config.Configuration) string {
+	if c.Msh.CheckpointFolder != "" {
+		return c.Msh.CheckpointFolder
+	}
+
+	return filepath.Join(c.Server.Folder, checkpointFolderName)
+}
+
+// newCheckpointDir creates the folder of a new checkpoint (named by creation time)
+func newCheckpointDir(c *config.Configuration) (string, *errco.MshLog) {
+	dir := filepath.Join(checkpointFolder(c), strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CHECKPOINT, err.Error())
+	}
+
+	return dir, nil
+}
+
+// checkpointDirs returns the checkpoint folders sorted from oldest to newest
+func checkpointDirs(c *config.Configuration) []string {
+	entries, err := os.ReadDir(checkpointFolder(c))
+	if err != nil {
+		return []string{}
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		if _, err := strconv.ParseInt(entry.Name(), 10, 64); entry.IsDir() && err == nil {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	// names have the same number of digits: lexical order is creation order
+	sort.Strings(dirs)
+
+	for i := range dirs {
+		dirs[i] = filepath.Join(checkpointFolder(c), dirs[i])
+	}
+
+	return dirs
+}
+
+// lastCheckpoint returns the newest checkpoint if it can be restored.
+//
+// Only the newest checkpoint is considered: restoring an older one would roll back the world.
+// A checkpoint that has already been restored is not restored again for the same reason.
+func lastCheckpoint(c *config.Configuration) (string, *model.Checkpoint, *errco.MshLog) {
+	dirs := checkpointDirs(c)
+	if len(dirs) == 0 {
+		return "", nil, errco.NewLog(errco.TYPE_INF, errco.LVL_3, errco.ERROR_CHECKPOINT, "no checkpoint found")
+	}
+	dir := dirs[len(dirs)-1]
+
+	meta, logMsh := readCheckpointMeta(dir)
+	if logMsh != nil {
+		return "", nil, logMsh.AddTrace()
+	}
+	if meta.Restored {
+		return "", nil, errco.NewLog(errco.TYPE_INF, errco.LVL_3, errco.ERROR_CHECKPOINT, "last checkpoint has already been restored")
+	}
+
+	logMsh = opsys.CriuVerify(dir)
+	if logMsh != nil {
+		return "", nil, logMsh.AddTrace()
+	}
+
+	return dir, meta, nil
+}
+
+// readCheckpointMeta reads the metadata of a checkpoint
+func readCheckpointMeta(dir string) (*model.Checkpoint, *errco.MshLog) {
+	var meta *model.Checkpoint = &model.Checkpoint{}
+
+	data, err := os.ReadFile(filepath.Join(dir, checkpointMetaFileName))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CHECKPOINT, "can't read checkpoint metadata: %s", err.Error())
+	}
+
+	err = json.Unmarshal(data, meta)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	return meta, nil
+}
+
+// writeCheckpointMeta writes the metadata of a checkpoint
+func writeCheckpointMeta(dir string, meta *model.Checkpoint) *errco.MshLog {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(dir, checkpointMetaFileName), data, 0600)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CHECKPOINT, "can't write checkpoint metadata: %s", err.Error())
+	}
+
+	return nil
+}
+
+// pruneCheckpoints removes the oldest checkpoints keeping the newest Msh.CheckpointKeep
+func pruneCheckpoints(c *config.Configuration) {
+	dirs := checkpointDirs(c)
+
+	for len(dirs) > c.Msh.CheckpointKeep && len(dirs) > 1 {
+		err := os.RemoveAll(dirs[0])
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CHECKPOINT, "can't remove checkpoint: %s", err.Error())
+		} else {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "removed old checkpoint (%s)", dirs[0])
+		}
+		dirs = dirs[1:]
+	}
+}
@@ -0,0 +1,69 @@
+package servctrl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/model"
+)
+
+func Test_lastCheckpoint(t *testing.T) {
+	c := &config.Configuration{}
+	c.Msh.CheckpointFolder = t.TempDir()
+	c.Msh.CheckpointKeep = 2
+
+	// newCheckpoint creates a checkpoint folder with fake criu images
+	newCheckpoint := func(complete bool) string {
+		dir, logMsh := newCheckpointDir(c)
+		if logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		if logMsh := writeCheckpointMeta(dir, &model.Checkpoint{Date: time.Now(), Pid: 1234, Pipes: []string{"pipe:[1]", "pipe:[2]", "pipe:[3]"}}); logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		dumpLog := "(00.5) Dumping finished successfully\n"
+		if !complete {
+			dumpLog = "(00.2) Error (criu/cr-dump.c:1000): Dumping FAILED.\n"
+		}
+		_ = os.WriteFile(filepath.Join(dir, "inventory.img"), []byte{}, 0600)
+		_ = os.WriteFile(filepath.Join(dir, "dump.log"), []byte(dumpLog), 0600)
+		return dir
+	}
+
+	if _, _, logMsh := lastCheckpoint(c); logMsh == nil {
+		t.Errorf("no checkpoint should be found in empty folder")
+	}
+
+	newCheckpoint(true)
+	last := newCheckpoint(true)
+
+	dir, meta, logMsh := lastCheckpoint(c)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if dir != last || meta.Pid != 1234 || len(meta.Pipes) != 3 {
+		t.Errorf("last checkpoint is %s (expected %s)", dir, last)
+	}
+
+	// restored checkpoint must not be restored again
+	meta.Restored = true
+	_ = writeCheckpointMeta(dir, meta)
+	if _, _, logMsh := lastCheckpoint(c); logMsh == nil {
+		t.Errorf("restored checkpoint should not be restored again")
+	}
+
+	// incomplete dump can't be restored (older checkpoints are not used)
+	newCheckpoint(false)
+	if _, _, logMsh := lastCheckpoint(c); logMsh == nil {
+		t.Errorf("incomplete checkpoint should not be restored")
+	}
+
+	// only the newest checkpoints are kept
+	pruneCheckpoints(c)
+	if dirs := checkpointDirs(c); len(dirs) != 2 || dirs[0] != last {
+		t.Errorf("pruned checkpoints are %v (expected 2 starting with %s)", dirs, last)
+	}
+}
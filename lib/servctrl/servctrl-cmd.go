@@ -4,20 +4,17 @@ import (
 	"bufio"
 	"encoding/json"
 	"io"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
-	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/events"
 	"msh/lib/model"
-	"msh/lib/opsys"
-	"msh/lib/servstats"
 	"msh/lib/utility"
 )
 
-// ServTerm is the variable that represent the running minecraft server
+// ServTerm is the variable that represent the running default minecraft server
 var ServTerm *servTerminal = &servTerminal{IsActive: false}
 
 // servTerminal is the minecraft server terminal
@@ -25,35 +22,57 @@ type servTerminal struct {
 	IsActive  bool
 	Wg        sync.WaitGroup // used to wait terminal StdoutPipe/StderrPipe
 	startTime time.Time      // time at which minecraft server terminal was started
-	cmd       *exec.Cmd
+	driver    serverDriver   // runs the minecraft server process
 	outPipe   io.ReadCloser
 	errPipe   io.ReadCloser
 	inPipe    io.WriteCloser
 }
 
-// lastOut is a channel used to communicate the last line got from the printer function
+// lastOut is a channel used to communicate the last line got from the printer function of the default minecraft server
 var lastOut = make(chan string)
 
 // Execute executes a command on ms.
 //
 // Returns the output lines of ms terminal with a timeout of 200ms since last output line.
+// If Commands.Rcon is enabled, the command is sent using rcon and the exact command response is returned.
 //
 // (Execute on command with no output doesn't cause hanging)
 //
 // (Execute on command with multiple lines returns them separated by \n, if print time between them was less than timeout)
 //
 // [non-blocking]
-func Execute(command string) (string, *errco.MshLog) {
+func (s *Server) Execute(command string) (string, *errco.MshLog) {
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := s.CheckMSWarm()
 	if logMsh != nil {
 		return "", logMsh.AddTrace()
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms command: %s%s%s\t(origin: %s%s%s)", errco.COLOR_CYAN, command, errco.COLOR_RESET, errco.COLOR_YELLOW, errco.Trace(2), errco.COLOR_RESET)
 
+	// send command using rcon
+	if s.Config.Commands.Rcon {
+		out, logMsh := s.rconExecute(command)
+		if logMsh != nil {
+			return "", logMsh.AddTrace()
+		}
+
+		// rcon output is not printed on ms terminal
+		for _, line := range strings.Split(out, "\n") {
+			if line != "" {
+				errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, "[rcon] %s", line)
+			}
+		}
+
+		return out, nil
+	}
+
+	if s.Config.Commands.Attach {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_TERMINAL_NOT_ACTIVE, "attached minecraft server has no terminal (enable Commands.Rcon to send commands)")
+	}
+
 	// write to server terminal (\n indicates the enter key)
-	_, err := ServTerm.inPipe.Write([]byte(command + "\n"))
+	_, err := s.Term.inPipe.Write([]byte(command + "\n"))
 	if err != nil {
 		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_PIPE_INPUT_WRITE, err.Error())
 	}
@@ -64,7 +83,7 @@ func Execute(command string) (string, *errco.MshLog) {
 a:
 	for {
 		select {
-		case lo := <-lastOut:
+		case lo := <-s.lastOut:
 			out += lo + "\n"
 		case <-time.NewTimer(200 * time.Millisecond).C:
 			break a
@@ -77,9 +96,9 @@ a:
 
 // TellRaw executes a tellraw on ms
 // [non-blocking]
-func TellRaw(reason, text, origin string) *errco.MshLog {
+func (s *Server) TellRaw(reason, text, origin string) *errco.MshLog {
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := s.CheckMSWarm()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
@@ -90,12 +109,26 @@ func TellRaw(reason, text, origin string) *errco.MshLog {
 	}
 
 	gameMessage = append([]byte("tellraw @a "), gameMessage...)
-	gameMessage = append(gameMessage, []byte("\n")...)
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms tellraw: %s%s%s\t(origin: %s)", errco.COLOR_YELLOW, string(gameMessage), errco.COLOR_RESET, origin)
 
+	// send tellraw using rcon
+	if s.Config.Commands.Rcon {
+		_, logMsh := s.rconExecute(string(gameMessage))
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		return nil
+	}
+
+	if s.Config.Commands.Attach {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_TERMINAL_NOT_ACTIVE, "attached minecraft server has no terminal (enable Commands.Rcon to send commands)")
+	}
+
+	gameMessage = append(gameMessage, []byte("\n")...)
+
 	// write to server terminal (\n indicates the enter key)
-	_, err = ServTerm.inPipe.Write(gameMessage)
+	_, err = s.Term.inPipe.Write(gameMessage)
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_PIPE_INPUT_WRITE, err.Error())
 	}
@@ -105,22 +138,22 @@ func TellRaw(reason, text, origin string) *errco.MshLog {
 
 // TermUpTime returns the current minecraft server terminal uptime.
 // If ms terminal is not running returns -1.
-func TermUpTime() int {
-	if !ServTerm.IsActive {
+func (s *Server) TermUpTime() int {
+	if !s.Term.IsActive {
 		return -1
 	}
 
-	return utility.RoundSec(time.Since(ServTerm.startTime))
+	return utility.RoundSec(time.Since(s.Term.startTime))
 }
 
 // WarmUpTime returns the current minecraft server warmed uptime.
 // If ms is not warm returns -1.
-func WarmUpTime() int {
-	if err := CheckMSWarm(); err != nil {
+func (s *Server) WarmUpTime() int {
+	if err := s.CheckMSWarm(); err != nil {
 		return -1
 	}
 
-	return utility.RoundSec(time.Since(servstats.Stats.WarmUpTime))
+	return utility.RoundSec(time.Since(s.Stats.WarmUpTime))
 }
 
 // CheckMSWarm checks if minecraft server is warm and it's possible to interact with it.
@@ -128,17 +161,17 @@ func WarmUpTime() int {
 // Checks if there is no major error, terminal is active, ms status is online and ms process not suspended.
 //
 // If ms is warm and interactable, returns nil
-func CheckMSWarm() *errco.MshLog {
+func (s *Server) CheckMSWarm() *errco.MshLog {
 	switch {
-	case servstats.Stats.MajorError != nil:
+	case s.Stats.MajorError != nil:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_UNRESPONDING, "minecraft server not responding")
-	case !ServTerm.IsActive:
+	case !s.Term.IsActive:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_TERMINAL_NOT_ACTIVE, "minecraft server terminal not active")
-	case servstats.Stats.Status == errco.SERVER_STATUS_SUSPENDED:
+	case s.Stats.Status == errco.SERVER_STATUS_SUSPENDED:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_SUSPENDED, "minecraft server is suspended")
-	case servstats.Stats.Status != errco.SERVER_STATUS_ONLINE:
+	case s.Stats.Status != errco.SERVER_STATUS_ONLINE:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server not online")
-	case servstats.Stats.Suspended:
+	case s.Stats.Suspended:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_SUSPENDED, "minecraft server is suspended")
 	}
 
@@ -148,77 +181,61 @@ func CheckMSWarm() *errco.MshLog {
 // termStart starts a new terminal.
 // If server terminal is already active it returns without doing anything
 // [non-blocking]
-func termStart() *errco.MshLog {
-	if ServTerm.IsActive {
+func (s *Server) termStart() *errco.MshLog {
+	if s.Term.IsActive {
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_IS_WARM, "minecraft server terminal already active")
 		return nil
 	}
 
-	logMsh := termLoad()
+	// attached ms is started by its supervisor
+	if s.Config.Commands.Attach {
+		return s.attachStart()
+	}
+
+	logMsh := s.termLoad()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
-	go printerOutErr()
-
-	err := ServTerm.cmd.Start()
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TERMINAL_START, err.Error())
+	s.Term.outPipe, s.Term.errPipe, s.Term.inPipe, logMsh = s.Term.driver.start()
+	if logMsh != nil {
+		return logMsh.AddTrace()
 	}
 
-	go waitForExit()
+	go s.printerOutErr()
+
+	go s.waitForExit()
 
 	return nil
 }
 
-// termLoad loads cmd/pipes into ServTerm
-func termLoad() *errco.MshLog {
-	// set terminal cmd
-	command, logMsh := config.ConfigRuntime.BuildCommandStartServer()
+// termLoad loads the server driver specified in config into server terminal
+func (s *Server) termLoad() *errco.MshLog {
+	driver, logMsh := newServerDriver(s.Config)
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
-	ServTerm.cmd = exec.Command(command[0], command[1:]...)
-	ServTerm.cmd.Dir = config.ConfigRuntime.Server.Folder
-
-	// launch as new process group so that signals (ex: SIGINT) are sent to msh
-	// (not relayed to the java server child process)
-	ServTerm.cmd.SysProcAttr = opsys.NewProcGroupAttr()
-
-	// set terminal pipes
-	var err error
-	ServTerm.outPipe, err = ServTerm.cmd.StdoutPipe()
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdoutPipe load: "+err.Error())
-	}
-	ServTerm.errPipe, err = ServTerm.cmd.StderrPipe()
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StderrPipe load: "+err.Error())
-	}
-	ServTerm.inPipe, err = ServTerm.cmd.StdinPipe()
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdinPipe load: "+err.Error())
-	}
+	s.Term.driver = driver
 
 	return nil
 }
 
 // printerOutErr manages the communication from StdoutPipe/StderrPipe.
 // Launches 1 goroutine to scan StdoutPipe and 1 goroutine to scan StderrPipe
-// (Should be called before cmd.Start())
+// (Should be called before waitForExit())
 // [goroutine]
-func printerOutErr() {
+func (s *Server) printerOutErr() {
 	// add printer-out + printer-err to waitgroup
-	ServTerm.Wg.Add(2)
+	s.Term.Wg.Add(2)
 
 	// print terminal StdoutPipe
 	// [goroutine]
 	go func() {
 		var line string
 
-		defer ServTerm.Wg.Done()
+		defer s.Term.Wg.Done()
 
-		scanner := bufio.NewScanner(ServTerm.outPipe)
+		scanner := bufio.NewScanner(s.Term.outPipe)
 
 		for scanner.Scan() {
 			line = scanner.Text()
@@ -228,11 +245,11 @@ func printerOutErr() {
 			// communicate to lastOut so that func Execute() can return the output of the command.
 			// must be a non-blocking select or it might cause hanging
 			select {
-			case lastOut <- line:
+			case s.lastOut <- line:
 			default:
 			}
 
-			switch servstats.Stats.Status {
+			switch s.Stats.Status {
 
 			case errco.SERVER_STATUS_STARTING:
 				// for modded server terminal compatibility, use separate check for "INFO" and flag-word
@@ -240,18 +257,13 @@ func printerOutErr() {
 
 				// "Preparing spawn area: " -> update ServStats.LoadProgress
 				if strings.Contains(line, "INFO") && strings.Contains(line, "Preparing spawn area: ") {
-					servstats.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
+					s.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
 				}
 
 				// ": Done (" -> set ServStats.Status = ONLINE
 				// using ": Done (" instead of "Done" to avoid false positives (issue #112)
 				if strings.Contains(line, "INFO") && strings.Contains(line, ": Done (") {
-					servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
-					errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE!")
-
-					// schedule soft freeze of ms
-					// (if no players connect the server will shutdown)
-					FreezeMSSchedule()
+					s.setOnline()
 				}
 
 			case errco.SERVER_STATUS_ONLINE:
@@ -282,12 +294,16 @@ func printerOutErr() {
 					switch {
 					// player leaves the server
 					case strings.Contains(lineContent, "lost connection:"): // "lost connection" is more general compared to "left the game" (even too much: player might write it in chat -> added ":")
-						FreezeMSSchedule()
+						s.FreezeMSSchedule()
 
 					// the server is stopping
 					case strings.Contains(lineContent, "Stopping") && strings.Contains(lineContent, "server"):
-						servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
-						errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STOPPING!")
+						s.setStopping()
+					}
+
+					// a player postpones hibernation
+					if player, isStay := parseStay(lineContent, s.Config.Msh.StayCommand); isStay {
+						go s.stay(player)
 					}
 				}
 
@@ -299,8 +315,15 @@ func printerOutErr() {
 						// [18:49:08 WARN]: Can't keep up! Is the server overloaded? Running 121938ms or 2438 ticks behind
 						// [18:49:08 ERROR]: ------------------------------
 						// [18:49:08 ERROR]: The server has stopped responding! This is (probably) not a Paper bug.
-						LogMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_UNRESPONDING, "MINECRAFT SERVER IS NOT RESPONDING!")
-						servstats.Stats.SetMajorError(LogMsh)
+						unresponding := s.Stats.MajorError == nil
+						LogMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_UNRESPONDING, "MINECRAFT SERVER IS NOT RESPONDING! (%s)", s.Name)
+						s.Stats.SetMajorError(LogMsh)
+						events.Publish(events.MAJOR_ERROR, s.Name, map[string]interface{}{"error": "minecraft server is not responding"})
+
+						// kill ms so that it's restarted (major error is cleared when ms is online again)
+						if unresponding && s.Config.Msh.RestartAllow {
+							go s.crashUnresponding()
+						}
 					}
 				}
 			}
@@ -312,9 +335,9 @@ func printerOutErr() {
 	go func() {
 		var line string
 
-		defer ServTerm.Wg.Done()
+		defer s.Term.Wg.Done()
 
-		scanner := bufio.NewScanner(ServTerm.errPipe)
+		scanner := bufio.NewScanner(s.Term.errPipe)
 
 		for scanner.Scan() {
 			line = scanner.Text()
@@ -326,47 +349,133 @@ func printerOutErr() {
 
 // waitForExit waits for server terminal to exit and manages:
 //
-// - ServTerm.isActive, ServTerm.startTime.
+// - Term.IsActive, Term.startTime.
 //
 // - Stats.Status, Stats.Suspended, Stats.ConnCount, Stats.LoadProgress.
 //
 // - Suspension refresher.
 //
 // [goroutine]
-func waitForExit() {
-	ServTerm.IsActive = true
-	ServTerm.startTime = time.Now()
+func (s *Server) waitForExit() {
+	s.setStarting()
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal started")
 
-	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
-	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
-	servstats.Stats.LoadProgress = "0%"
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STARTING!")
+	// ms restored from checkpoint is already online
+	// (restore duration is not recorded as boot duration)
+	if s.Term.driver.restored() {
+		events.Publish(events.RESTORED, s.Name, nil)
+		s.Stats.Status = errco.SERVER_STATUS_ONLINE
+		s.setOnline()
+	}
 
 	// start suspension refresher
 	stopSuspendRefresherC := make(chan bool, 1)
-	go suspendRefresher(stopSuspendRefresherC)
+	go s.suspendRefresher(stopSuspendRefresherC)
 
 	// wait for server process to finish
-	ServTerm.Wg.Wait()  // wait terminal StdoutPipe/StderrPipe to exit
-	ServTerm.cmd.Wait() // wait process (to avoid defunct java server process)
+	s.Term.Wg.Wait()                 // wait terminal StdoutPipe/StderrPipe to exit
+	exitCode := s.Term.driver.wait() // wait process (to avoid defunct java server process)
 
-	ServTerm.outPipe.Close()
-	ServTerm.errPipe.Close()
-	ServTerm.inPipe.Close()
+	s.Term.outPipe.Close()
+	s.Term.errPipe.Close()
+	s.Term.inPipe.Close()
 
 	// stop suspension refresher
 	stopSuspendRefresherC <- true
 
-	servstats.Stats.Status = errco.SERVER_STATUS_OFFLINE
-	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
-	servstats.Stats.LoadProgress = "0%"
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS OFFLINE!")
+	// check if ms crashed (exited while it was not stopping)
+	crashed, reason := s.crashed(s.Stats.Status, exitCode)
+	if !crashed {
+		s.crashM.Lock()
+		s.crashes = 0
+		s.crashM.Unlock()
+	}
+
+	// world is consistent when ms has exited: back it up before ms can be woken again
+	s.backingUp.Store(s.Config.Msh.BackupAllow)
+
+	s.setOffline()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal exited (exit code %d)", exitCode)
+
+	if s.backingUp.Load() {
+		if logMsh := s.backupWorld(); logMsh != nil {
+			logMsh.Log(true)
+		}
+		s.backingUp.Store(false)
+	}
+
+	// restart crashed ms according to restart policy
+	if crashed {
+		s.crashRecover(reason)
+	}
+}
+
+// setStarting sets ms terminal as active and ms status as starting
+func (s *Server) setStarting() {
+	s.Term.IsActive = true
+	s.Term.startTime = time.Now()
+
+	s.Stats.Status = errco.SERVER_STATUS_STARTING
+	s.Stats.Suspended = false
+	s.Stats.ConnCount = 0
+	s.Stats.LoadProgress = "0%"
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STARTING! (%s)", s.Name)
+	events.Publish(events.STARTING, s.Name, nil)
+}
+
+// setOnline sets ms status as online and schedules ms soft freeze.
+// If ms was starting, the boot duration is recorded.
+func (s *Server) setOnline() {
+	booting := s.Stats.Status == errco.SERVER_STATUS_STARTING
+
+	s.Stats.Status = errco.SERVER_STATUS_ONLINE
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE! (%s)", s.Name)
+	events.Publish(events.ONLINE, s.Name, nil)
+
+	// schedule soft freeze of ms
+	// (if no players connect the server will shutdown)
+	s.FreezeMSSchedule()
+
+	// update status shown to clients while ms is not online
+	go s.refreshStatusCache()
+
+	// record boot duration to estimate the next boots
+	// (ms recovered from major errors, like a crash, when it boots successfully)
+	if booting {
+		if logMsh := s.recordBoot(time.Since(s.Term.startTime)); logMsh != nil {
+			logMsh.Log(true)
+		}
+		s.Stats.MajorError = nil
+		s.crashM.Lock()
+		s.crashLoop = false
+		s.crashM.Unlock()
+	}
+}
+
+// setStopping sets ms status as stopping
+func (s *Server) setStopping() {
+	s.Stats.Status = errco.SERVER_STATUS_STOPPING
+	s.Stats.LastOnline = time.Now()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STOPPING! (%s)", s.Name)
+	events.Publish(events.STOPPING, s.Name, nil)
+}
+
+// setOffline sets ms status as offline and ms terminal as not active
+func (s *Server) setOffline() {
+	if s.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		s.Stats.LastOnline = time.Now()
+	}
+	s.Stats.Status = errco.SERVER_STATUS_OFFLINE
+	s.Stats.Suspended = false
+	s.Stats.ConnCount = 0
+	s.Stats.LoadProgress = "0%"
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS OFFLINE! (%s)", s.Name)
+	events.Publish(events.OFFLINE, s.Name, nil)
+
+	// close rcon connection to the exited ms
+	s.rcon.close()
 
-	ServTerm.IsActive = false
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal exited")
+	s.Term.IsActive = false
 }
 
 // suspendRefresher refreshes ms suspension by warming and freezing the server every set amount of time.
@@ -374,18 +483,18 @@ func waitForExit() {
 // If (suspension || suspension refresh) is not allowed this func just returns.
 //
 // [goroutine stoppable]
-func suspendRefresher(stop chan bool) {
-	if !config.ConfigRuntime.Msh.SuspendAllow {
+func (s *Server) suspendRefresher(stop chan bool) {
+	if !s.Config.Msh.SuspendAllow {
 		return
 	}
 
-	if config.ConfigRuntime.Msh.SuspendRefresh <= 0 {
+	if s.Config.Msh.SuspendRefresh <= 0 {
 		return
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "suspension refresher is starting")
 
-	ticker := time.NewTicker(time.Duration(config.ConfigRuntime.Msh.SuspendRefresh) * time.Second)
+	ticker := time.NewTicker(time.Duration(s.Config.Msh.SuspendRefresh) * time.Second)
 
 	for {
 		select {
@@ -398,27 +507,27 @@ func suspendRefresher(stop chan bool) {
 		case <-ticker.C:
 			// check if ms is responding, not offline, suspended
 			switch {
-			case servstats.Stats.MajorError != nil:
+			case s.Stats.MajorError != nil:
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_UNRESPONDING, "minecraft server is not responding")
 				continue
-			case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+			case s.Stats.Status == errco.SERVER_STATUS_OFFLINE:
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE, "minecraft server is offline")
 				continue
-			case !servstats.Stats.Suspended:
+			case !s.Stats.Suspended:
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_SUSPENDED, "minecraft server terminal is not suspended")
 				continue
 			}
 
 			// warm ms unsuspending process
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will warm minecraft server...")
-			WarmMS()
+			s.WarmMS()
 
 			// give time to ms to recover from suspension
 			time.Sleep(1 * time.Second)
 
 			// freeze ms suspending process (softly in case a player has joined in the meantime)
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will freeze minecraft server...")
-			FreezeMS(false)
+			s.FreezeMS(false)
 		}
 	}
 }
@@ -0,0 +1,176 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/utility"
+)
+
+// FreezeMSCountdown warns online players with a countdown (Msh.FreezeWarnings) and then force freezes ms.
+//
+// If cancellable, a player can send Msh.StayCommand during the countdown to cancel the freeze:
+// hibernation is postponed by Msh.StayTime and a soft freeze is scheduled.
+//
+// If no warning is set or ms is empty, ms is force frozen immediately.
+//
+// [blocking]
+func (s *Server) FreezeMSCountdown(cancellable bool) *errco.MshLog {
+	warnings := freezeWarnings(s.Config.Msh.FreezeWarnings)
+
+	if len(warnings) == 0 || s.Stats.Status != errco.SERVER_STATUS_ONLINE || s.Stats.Suspended || s.countPlayerSafe() == 0 {
+		return s.FreezeMS(true)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER WILL BE STOPPED IN %s! (%s)", utility.HumanDuration(time.Duration(warnings[0])*time.Second), s.Name)
+
+	stayC := make(chan string, 1)
+	s.stayM.Lock()
+	s.stayC = stayC
+	s.stayM.Unlock()
+	defer func() {
+		s.stayM.Lock()
+		s.stayC = nil
+		s.stayM.Unlock()
+	}()
+
+	for i, w := range warnings {
+		// ms might have been stopped in the meantime
+		if s.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			return nil
+		}
+
+		s.freezeWarn(time.Duration(w) * time.Second)
+
+		next := 0
+		if i+1 < len(warnings) {
+			next = warnings[i+1]
+		}
+
+		if player, postponed := s.countdownWait(time.Duration(w-next)*time.Second, stayC, cancellable); postponed {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server stop cancelled by %s (%s)", player, s.Name)
+			s.FreezeMSSchedule()
+			return nil
+		}
+	}
+
+	return s.FreezeMS(true)
+}
+
+// countdownWait waits for d or until a player postpones hibernation with a stay command.
+//
+// If the countdown is not cancellable, stay commands are refused and the full d is waited.
+// Returns the player that postponed hibernation: player, true.
+func (s *Server) countdownWait(d time.Duration, stayC chan string, cancellable bool) (string, bool) {
+	deadline := time.Now().Add(d)
+
+	for {
+		select {
+		case <-time.After(time.Until(deadline)):
+			return "", false
+		case player := <-stayC:
+			if !cancellable {
+				_ = s.TellRaw("hibernation", "this stop can't be postponed", "FreezeMSCountdown")
+				continue
+			}
+
+			s.postpone(player)
+			return player, true
+		}
+	}
+}
+
+// stay manages a stay command sent by a player.
+// If a freeze countdown is running, it decides whether hibernation is postponed, otherwise hibernation is postponed.
+func (s *Server) stay(player string) {
+	s.stayM.Lock()
+	stayC := s.stayC
+	s.stayM.Unlock()
+
+	if stayC == nil {
+		s.postpone(player)
+		return
+	}
+
+	// notify freeze countdown (non-blocking)
+	select {
+	case stayC <- player:
+	default:
+	}
+}
+
+// postpone postpones hibernation of ms by Msh.StayTime (requested by a player with Msh.StayCommand)
+func (s *Server) postpone(player string) {
+	stayTime := time.Duration(s.Config.Msh.StayTime) * time.Second
+
+	s.stayM.Lock()
+	s.stayUntil = time.Now().Add(stayTime)
+	s.stayM.Unlock()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%s postponed hibernation by %s (%s)", player, utility.HumanDuration(stayTime), s.Name)
+	_ = s.TellRaw("hibernation", player+" postponed hibernation by "+utility.HumanDuration(stayTime), "stay")
+}
+
+// staying returns true if hibernation is postponed by a player
+func (s *Server) staying() bool {
+	s.stayM.Lock()
+	defer s.stayM.Unlock()
+
+	return time.Now().Before(s.stayUntil)
+}
+
+// freezeWarn sends the freeze warning to online players
+func (s *Server) freezeWarn(d time.Duration) {
+	message := strings.NewReplacer("{time}", utility.HumanDuration(d), "{stay}", s.Config.Msh.StayCommand).Replace(s.Config.Msh.FreezeWarningMessage)
+
+	logMsh := s.TellRaw("hibernation", message, "freezeWarn")
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+
+	if s.Config.Msh.FreezeWarningTitle {
+		title, err := json.Marshal(&model.GameRawMessage{Text: message, Color: "aqua", Bold: false})
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_JSON_MARSHAL, err.Error())
+			return
+		}
+		_, logMsh = s.Execute("title @a title " + string(title))
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
+
+// parseStay returns the player that sent the stay command in a ms chat line content (ex: "<player> !stay").
+// If the line is not a stay command returns: "", false
+func parseStay(lineContent, stayCommand string) (string, bool) {
+	if stayCommand == "" || !strings.HasPrefix(lineContent, "<") {
+		return "", false
+	}
+
+	player, message, found := strings.Cut(lineContent[1:], "> ")
+	if !found || strings.TrimSpace(message) != stayCommand {
+		return "", false
+	}
+
+	return player, true
+}
+
+// freezeWarnings returns the valid freeze warnings sorted from the earliest (longest time before stop)
+func freezeWarnings(warnings []int) []int {
+	sorted := []int{}
+	for _, w := range warnings {
+		if w > 0 {
+			sorted = append(sorted, w)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	return sorted
+}
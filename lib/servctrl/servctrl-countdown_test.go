@@ -0,0 +1,67 @@
+package servctrl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/servstats"
+)
+
+func Test_parseStay(t *testing.T) {
+	tests := []struct {
+		lineContent string
+		stayCommand string
+		player      string
+		isStay      bool
+	}{
+		{"<steve> !stay", "!stay", "steve", true},
+		{"<steve> !stay ", "!stay", "steve", true},
+		{"<steve> !stay please", "!stay", "", false},
+		{"<steve> !stay", "", "", false},      // stay command disabled
+		{"[steve] !stay", "!stay", "", false}, // not a chat message
+		{"steve lost connection: !stay", "!stay", "", false},
+	}
+
+	for _, test := range tests {
+		player, isStay := parseStay(test.lineContent, test.stayCommand)
+		if player != test.player || isStay != test.isStay {
+			t.Errorf("parse stay of \"%s\" is %s, %t (expected %s, %t)", test.lineContent, player, isStay, test.player, test.isStay)
+		}
+	}
+}
+
+func Test_freezeWarnings(t *testing.T) {
+	if w := freezeWarnings([]int{10, 300, 0, 60, -5}); !reflect.DeepEqual(w, []int{300, 60, 10}) {
+		t.Errorf("freeze warnings are %v (expected [300 60 10])", w)
+	}
+}
+
+func Test_countdownWait(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Msh.StayTime = 600
+
+	// stay command can't shorten a countdown that can't be postponed
+	stayC := make(chan string, 1)
+	stayC <- "steve"
+	start := time.Now()
+	if _, postponed := s.countdownWait(200*time.Millisecond, stayC, false); postponed {
+		t.Errorf("countdown that can't be postponed was postponed")
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Errorf("countdown waited %s (expected 200ms)", waited)
+	}
+	if s.staying() {
+		t.Errorf("refused stay command should not postpone hibernation")
+	}
+
+	// stay command cancels a countdown that can be postponed
+	stayC <- "steve"
+	if player, postponed := s.countdownWait(time.Minute, stayC, true); !postponed || player != "steve" {
+		t.Errorf("countdown should be postponed by steve")
+	}
+	if !s.staying() {
+		t.Errorf("accepted stay command should postpone hibernation")
+	}
+}
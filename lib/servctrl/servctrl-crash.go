@@ -0,0 +1,202 @@
+package servctrl
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/utility"
+)
+
+const (
+	// crashReportsFolder is the folder (in minecraft server folder) where ms writes its crash reports
+	crashReportsFolder string = "crash-reports"
+
+	// crashStableUptime is the uptime after which a crash of ms is not counted as consecutive to the previous ones
+	crashStableUptime time.Duration = 10 * time.Minute
+
+	// restartBackoffMax is the max time waited before restarting ms after a crash
+	restartBackoffMax time.Duration = 30 * time.Minute
+)
+
+// CrashLoop returns true if ms kept crashing after being restarted (ms is not restarted anymore)
+func (s *Server) CrashLoop() bool {
+	s.crashM.Lock()
+	defer s.crashM.Unlock()
+	return s.crashLoop
+}
+
+// StartMS warms ms on user request (msh start console command or api start).
+// If ms is in a crash loop, the crash loop is reset so that ms is started again.
+// [non-blocking]
+func (s *Server) StartMS() *errco.MshLog {
+	s.crashM.Lock()
+	crashLoop := s.crashLoop
+	s.crashes, s.crashLoop = 0, false
+	s.crashM.Unlock()
+
+	if crashLoop {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "crash loop reset by user: starting minecraft server again (%s)", s.Name)
+		s.Stats.MajorError = nil
+	}
+
+	return s.WarmMS()
+}
+
+// crashed returns true if the exited ms has crashed and the reason.
+//
+// ms has crashed if it exited while it was not stopping, with a non-zero exit code or after writing a crash report.
+// (status is the ms status before exiting, exitCode is -1 if unknown)
+func (s *Server) crashed(status, exitCode int) (bool, string) {
+	if status == errco.SERVER_STATUS_STOPPING {
+		return false, ""
+	}
+
+	if report := crashReport(filepath.Join(s.Config.Server.Folder, crashReportsFolder), s.Term.startTime); report != "" {
+		return true, "crash report " + report
+	}
+
+	switch exitCode {
+	case 0:
+		return false, ""
+	case -1:
+		return true, "killed or exited with unknown code"
+	default:
+		return true, "exit code " + strconv.Itoa(exitCode)
+	}
+}
+
+// crashRecover manages a crash of ms according to the restart policy.
+//
+// If Msh.RestartAllow is enabled, ms is restarted with a backoff that doubles at each consecutive crash.
+// After Msh.RestartMax consecutive restarts ms is in a crash loop: it's not restarted anymore
+// and clients are refused with Msh.InfoCrashLoop.
+func (s *Server) crashRecover(reason string) {
+	s.Stats.M.Lock()
+	s.Stats.Crashes++
+	s.Stats.M.Unlock()
+
+	s.crashM.Lock()
+	// a crash after a long uptime does not belong to a crash loop
+	if time.Since(s.Term.startTime) >= crashStableUptime {
+		s.crashes = 0
+	}
+	s.crashes++
+	crashes := s.crashes
+	if s.Config.Msh.RestartAllow && crashes > s.Config.Msh.RestartMax {
+		s.crashLoop = true
+	}
+	crashLoop := s.crashLoop
+	s.crashM.Unlock()
+
+	errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_CRASH, "MINECRAFT SERVER HAS CRASHED! (%s: %s)", s.Name, reason)
+	events.Publish(events.CRASHED, s.Name, map[string]interface{}{"reason": reason, "crashes": crashes})
+
+	if !s.Config.Msh.RestartAllow {
+		return
+	}
+
+	if crashLoop {
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_CRASH_LOOP, "MINECRAFT SERVER IS IN A CRASH LOOP! it crashed %d times in a row and won't be restarted (%s)", crashes, s.Name)
+		s.Stats.MajorError = nil
+		s.Stats.SetMajorError(logMsh)
+		events.Publish(events.CRASH_LOOP, s.Name, map[string]interface{}{"reason": reason, "crashes": crashes})
+		return
+	}
+
+	backoff := restartBackoff(time.Duration(s.Config.Msh.RestartBackoff)*time.Second, crashes)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "restarting minecraft server in %s (restart %d/%d) (%s)", utility.HumanDuration(backoff), crashes, s.Config.Msh.RestartMax, s.Name)
+
+	time.AfterFunc(backoff, s.crashRestart)
+}
+
+// crashRestart restarts the crashed ms.
+// The major error (if any) is kept until ms is online again.
+// [goroutine]
+func (s *Server) crashRestart() {
+	// ms might have been woken in the meantime
+	if s.Stats.Status != errco.SERVER_STATUS_OFFLINE || s.Term.IsActive {
+		return
+	}
+
+	// don't restart ms during a hibernate window
+	if message, hibernating := s.ScheduleHibernation(); hibernating {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SCHEDULE, "minecraft server won't be restarted: %s", message)
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "restarting crashed minecraft server (%s)", s.Name)
+	events.Publish(events.WARMING, s.Name, nil)
+
+	logMsh := s.termStart()
+	if logMsh != nil {
+		logMsh.Log(true)
+		s.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
+		events.Publish(events.MAJOR_ERROR, s.Name, map[string]interface{}{"error": "error starting minecraft server (check logs)"})
+		return
+	}
+
+	// set mc warmup time
+	s.Stats.WarmUpTime = time.Now()
+
+	// schedule soft freeze of ms
+	// (restarted ms is frozen if no player joins)
+	s.FreezeMSSchedule()
+}
+
+// crashUnresponding kills the unresponding ms so that it's restarted by the restart policy
+func (s *Server) crashUnresponding() {
+	errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_UNRESPONDING, "minecraft server is not responding: killing it to restart it (%s)", s.Name)
+
+	logMsh := s.procKill()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+	s.Stats.M.Lock()
+	s.Stats.Kills++
+	s.Stats.M.Unlock()
+	events.Publish(events.KILLED, s.Name, nil)
+}
+
+// restartBackoff returns the time to wait before restarting ms after the specified consecutive crashes
+// (base doubled at each consecutive crash, at most restartBackoffMax)
+func restartBackoff(base time.Duration, crashes int) time.Duration {
+	backoff := base
+	for i := 1; i < crashes && backoff < restartBackoffMax; i++ {
+		backoff *= 2
+	}
+
+	if backoff > restartBackoffMax {
+		return restartBackoffMax
+	}
+
+	return backoff
+}
+
+// crashReport returns the name of the newest crash report written in folder after since.
+// If there is no such crash report returns "".
+func crashReport(folder string, since time.Time) string {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return ""
+	}
+
+	newest, newestTime := "", since
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "crash-") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().After(newestTime) {
+			continue
+		}
+		newest, newestTime = e.Name(), info.ModTime()
+	}
+
+	return newest
+}
@@ -0,0 +1,122 @@
+package servctrl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+func Test_crashed(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Server.Folder = t.TempDir()
+	s.Term.startTime = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		status   int
+		exitCode int
+		crashed  bool
+	}{
+		{errco.SERVER_STATUS_ONLINE, 0, false},
+		{errco.SERVER_STATUS_ONLINE, 1, true},
+		{errco.SERVER_STATUS_STARTING, -1, true},
+		{errco.SERVER_STATUS_STOPPING, -1, false}, // killed by msh after stop timeout
+	}
+	for _, tt := range tests {
+		if crashed, reason := s.crashed(tt.status, tt.exitCode); crashed != tt.crashed {
+			t.Errorf("status %d exit code %d: crashed is %t (expected %t, reason: %s)", tt.status, tt.exitCode, crashed, tt.crashed, reason)
+		}
+	}
+
+	// crash reports older than ms start are ignored
+	reports := filepath.Join(s.Config.Server.Folder, crashReportsFolder)
+	_ = os.MkdirAll(reports, 0755)
+	old := filepath.Join(reports, "crash-2024-01-01_10.00.00-server.txt")
+	_ = os.WriteFile(old, []byte{}, 0644)
+	_ = os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	if crashed, _ := s.crashed(errco.SERVER_STATUS_ONLINE, 0); crashed {
+		t.Errorf("crash report written before ms start should be ignored")
+	}
+
+	_ = os.WriteFile(filepath.Join(reports, "crash-2024-01-02_10.00.00-server.txt"), []byte{}, 0644)
+	if crashed, reason := s.crashed(errco.SERVER_STATUS_ONLINE, 0); !crashed || reason != "crash report crash-2024-01-02_10.00.00-server.txt" {
+		t.Errorf("ms should have crashed because of new crash report (reason: %s)", reason)
+	}
+}
+
+func Test_crashRecover(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Msh.RestartAllow = true
+	s.Config.Msh.RestartMax = 1
+	s.Config.Msh.RestartBackoff = 3600 // restart is not executed during test
+	s.Term.startTime = time.Now()
+
+	s.crashRecover("exit code 1")
+	if s.CrashLoop() || s.Stats.MajorError != nil {
+		t.Fatalf("first crash should restart ms")
+	}
+
+	s.crashRecover("exit code 1")
+	if !s.CrashLoop() || s.Stats.MajorError == nil || s.Stats.Crashes != 2 {
+		t.Errorf("second consecutive crash should put ms in a crash loop")
+	}
+
+	// a crash after a long uptime resets consecutive crashes
+	s.crashLoop = false
+	s.Stats.MajorError = nil
+	s.Term.startTime = time.Now().Add(-crashStableUptime)
+	s.crashRecover("exit code 1")
+	if s.CrashLoop() || s.crashes != 1 {
+		t.Errorf("crash after %s of uptime should not be consecutive (crashes: %d)", crashStableUptime, s.crashes)
+	}
+}
+
+func Test_StartMS(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats(), Term: &servTerminal{}}
+	s.Config.Server.Folder = t.TempDir()
+	s.Config.Msh.RestartAllow = true
+	s.Config.Msh.RestartMax = 0
+	s.Config.Msh.TimeBeforeStoppingEmptyServer = 3600 // scheduled freeze is not executed during test
+	s.Term.startTime = time.Now()
+
+	// ms is started by a hook so that the start is not asynchronous
+	s.Config.Commands.Attach = true
+	s.Config.Commands.AttachStart = "echo > started"
+
+	s.crashRecover("exit code 1")
+	if !s.CrashLoop() || s.WarmMS() == nil {
+		t.Fatalf("ms in crash loop should not be woken")
+	}
+
+	// a manual start resets the crash loop and starts ms again
+	if logMsh := s.StartMS(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if _, err := os.Stat(filepath.Join(s.Config.Server.Folder, "started")); err != nil {
+		t.Fatalf("ms was not started again after manual start")
+	}
+	if s.CrashLoop() || s.crashes != 0 || s.Stats.MajorError != nil || s.Stats.Status != errco.SERVER_STATUS_STARTING {
+		t.Errorf("crash loop should be reset (crashes: %d, major error: %v, status: %d)", s.crashes, s.Stats.MajorError, s.Stats.Status)
+	}
+}
+
+func Test_restartBackoff(t *testing.T) {
+	tests := []struct {
+		crashes int
+		backoff time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{20, restartBackoffMax},
+	}
+	for _, tt := range tests {
+		if backoff := restartBackoff(10*time.Second, tt.crashes); backoff != tt.backoff {
+			t.Errorf("backoff after %d crashes is %s (expected %s)", tt.crashes, backoff, tt.backoff)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package servctrl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// reference:
+// - docs.docker.com/engine/api/latest
+
+const dockerSocketDefault string = "/var/run/docker.sock" // default docker engine api socket
+
+// dockerDriver runs ms in a docker container using the docker engine api (unix socket).
+//
+// Console output is streamed from container logs, console input is sent by attaching to container stdin
+// (the container must be created with stdin open: "docker run -i" / "stdin_open: true").
+// Suspension pauses the container.
+type dockerDriver struct {
+	socket    string       // docker engine api unix socket
+	container string       // name or id of ms container
+	client    *http.Client // http client connected to the docker engine api socket
+}
+
+// dockerInspect is the part of the container inspect response used by msh
+type dockerInspect struct {
+	Config struct {
+		Tty       bool `json:"Tty"`
+		OpenStdin bool `json:"OpenStdin"`
+	} `json:"Config"`
+	State struct {
+		Pid int `json:"Pid"` // pid of container main process (0 if not running)
+	} `json:"State"`
+}
+
+// newDockerDriver returns a docker driver for the specified container.
+// If socket is empty, the default docker socket is used.
+func newDockerDriver(socket, container string) *dockerDriver {
+	if socket == "" {
+		socket = dockerSocketDefault
+	}
+
+	return &dockerDriver{
+		socket:    socket,
+		container: container,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (d *dockerDriver) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.MshLog) {
+	inspect, logMsh := d.inspect()
+	if logMsh != nil {
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+
+	// attach to container stdin before starting it so that console input is available when ms starts
+	var inPipe io.WriteCloser
+	if inspect.Config.OpenStdin {
+		inPipe, logMsh = d.attachStdin()
+		if logMsh != nil {
+			return nil, nil, nil, logMsh.AddTrace()
+		}
+	} else {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_DOCKER, "stdin of container %s is not open: commands can be sent only using rcon", d.container)
+		pr, pw := io.Pipe()
+		pr.CloseWithError(errors.New("container stdin is not open"))
+		inPipe = pw
+	}
+
+	startTime := time.Now()
+
+	// 304: container already started
+	resp, logMsh := d.request(http.MethodPost, "/start", http.StatusNoContent, http.StatusNotModified)
+	if logMsh != nil {
+		inPipe.Close()
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+	resp.Body.Close()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "started container %s", d.container)
+
+	// stream logs of the current container run
+	since := fmt.Sprintf("%d.%09d", startTime.Unix(), startTime.Nanosecond())
+	resp, logMsh = d.request(http.MethodGet, "/logs?follow=1&stdout=1&stderr=1&since="+since, http.StatusOK)
+	if logMsh != nil {
+		inPipe.Close()
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+
+	// tty container logs are not multiplexed
+	if inspect.Config.Tty {
+		return resp.Body, io.NopCloser(strings.NewReader("")), inPipe, nil
+	}
+
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	go dockerDemux(resp.Body, outW, errW)
+
+	return outR, errR, inPipe, nil
+}
+
+func (d *dockerDriver) wait() int {
+	resp, logMsh := d.request(http.MethodPost, "/wait?condition=not-running", http.StatusOK)
+	if logMsh != nil {
+		logMsh.Log(true)
+		return -1
+	}
+	defer resp.Body.Close()
+
+	// wait response is sent when the container exits
+	var exit struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&exit)
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, "container wait response: %s", err.Error())
+		return -1
+	}
+
+	return exit.StatusCode
+}
+
+func (d *dockerDriver) suspend() (bool, *errco.MshLog) {
+	resp, logMsh := d.request(http.MethodPost, "/pause", http.StatusNoContent)
+	if logMsh != nil {
+		return false, logMsh.AddTrace()
+	}
+	resp.Body.Close()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CONTAINER PAUSE!")
+
+	return true, nil
+}
+
+func (d *dockerDriver) resume() (bool, *errco.MshLog) {
+	// 409: container is not paused
+	resp, logMsh := d.request(http.MethodPost, "/unpause", http.StatusNoContent, http.StatusConflict)
+	if logMsh != nil {
+		return true, logMsh.AddTrace()
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CONTAINER UNPAUSE!")
+	}
+
+	return false, nil
+}
+
+func (d *dockerDriver) kill() *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "killing container %s", d.container)
+
+	resp, logMsh := d.request(http.MethodPost, "/kill", http.StatusNoContent)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// reclaim swaps out the memory of the container process tree (msh must run on the docker host)
+func (d *dockerDriver) reclaim() (uint64, *errco.MshLog) {
+	inspect, logMsh := d.inspect()
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	return opsys.MemReclaim("", uint32(inspect.State.Pid))
+}
+
+// prefault loads back the swapped out memory of the container process tree (msh must run on the docker host)
+func (d *dockerDriver) prefault() *errco.MshLog {
+	inspect, logMsh := d.inspect()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return opsys.MemPrefault("", uint32(inspect.State.Pid))
+}
+
+// checkpoint is not supported: docker checkpoints are experimental and require the docker daemon to run criu
+func (d *dockerDriver) checkpoint(dir string) *errco.MshLog {
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CHECKPOINT, "checkpoint is not supported by docker driver")
+}
+
+func (d *dockerDriver) restored() bool {
+	return false
+}
+
+// inspect returns the info of ms container
+func (d *dockerDriver) inspect() (*dockerInspect, *errco.MshLog) {
+	var inspect *dockerInspect = &dockerInspect{}
+
+	resp, logMsh := d.request(http.MethodGet, "/json", http.StatusOK)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	defer resp.Body.Close()
+
+	err := json.NewDecoder(resp.Body).Decode(inspect)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	return inspect, nil
+}
+
+// request performs a request to the docker engine api for ms container (path is relative to the container endpoint).
+// If the response status code is not one of the expected ones, an error is returned.
+func (d *dockerDriver) request(method, path string, expected ...int) (*http.Response, *errco.MshLog) {
+	req, err := http.NewRequest(method, d.url(path), nil)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	// docker engine api errors are returned as {"message": "..."}
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+	resp.Body.Close()
+
+	return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, "docker %s %s: %s (%s)", method, path, resp.Status, apiErr.Message)
+}
+
+// attachStdin attaches to ms container stdin and returns the hijacked connection on which console input is written
+func (d *dockerDriver) attachStdin() (net.Conn, *errco.MshLog) {
+	conn, err := net.Dial("unix", d.socket)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url("/attach?stream=1&stdin=1"), nil)
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, err.Error())
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, "docker attach: %s", resp.Status)
+	}
+
+	return conn, nil
+}
+
+// url returns the docker engine api url of ms container endpoint
+func (d *dockerDriver) url(path string) string {
+	return "http://docker/containers/" + url.PathEscape(d.container) + path
+}
+
+// dockerDemux splits the multiplexed log stream of a non-tty container into stdout and stderr.
+//
+// Each frame has an 8 bytes header: [stream type, 0, 0, 0, size (uint32 big endian)] followed by size bytes of payload.
+//
+// [goroutine]
+func dockerDemux(stream io.ReadCloser, outW, errW *io.PipeWriter) {
+	defer stream.Close()
+	defer outW.Close()
+	defer errW.Close()
+
+	header := make([]byte, 8)
+
+	for {
+		_, err := io.ReadFull(stream, header)
+		if err != nil {
+			return
+		}
+
+		w := outW
+		if header[0] == 2 {
+			w = errW
+		}
+
+		_, err = io.CopyN(w, stream, int64(binary.BigEndian.Uint32(header[4:])))
+		if err != nil {
+			return
+		}
+	}
+}
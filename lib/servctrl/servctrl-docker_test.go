@@ -0,0 +1,165 @@
+package servctrl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDocker is a fake docker engine api listening on a unix socket
+type fakeDocker struct {
+	socket  string
+	stdin   chan string // lines received on container stdin
+	paused  bool
+	killed  bool
+	started bool
+}
+
+func newFakeDocker(t *testing.T) *fakeDocker {
+	fd := &fakeDocker{socket: filepath.Join(t.TempDir(), "docker.sock"), stdin: make(chan string, 10)}
+
+	l, err := net.Listen("unix", fd.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/mc/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Config":{"Tty":false,"OpenStdin":true}}`)
+	})
+	mux.HandleFunc("/containers/mc/attach", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		rw.Flush()
+
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(rw)
+			for scanner.Scan() {
+				fd.stdin <- scanner.Text()
+			}
+		}()
+	})
+	mux.HandleFunc("/containers/mc/start", func(w http.ResponseWriter, r *http.Request) {
+		fd.started = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/mc/logs", func(w http.ResponseWriter, r *http.Request) {
+		frame := func(stream byte, payload string) []byte {
+			header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+			return append(header, payload...)
+		}
+		w.Write(frame(1, "[Server thread/INFO]: Starting minecraft server\n"))
+		w.Write(frame(2, "warning\n"))
+		w.Write(frame(1, "[Server thread/INFO]: Done (1.0s)!\n"))
+	})
+	mux.HandleFunc("/containers/mc/wait", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"StatusCode":137}`)
+	})
+	mux.HandleFunc("/containers/mc/pause", func(w http.ResponseWriter, r *http.Request) {
+		fd.paused = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/mc/unpause", func(w http.ResponseWriter, r *http.Request) {
+		if !fd.paused {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message":"Container mc is not paused"}`)
+			return
+		}
+		fd.paused = false
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/mc/kill", func(w http.ResponseWriter, r *http.Request) {
+		fd.killed = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return fd
+}
+
+func Test_dockerDriver(t *testing.T) {
+	fd := newFakeDocker(t)
+	d := newDockerDriver(fd.socket, "mc")
+
+	outPipe, errPipe, inPipe, logMsh := d.start()
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if !fd.started {
+		t.Errorf("container should be started")
+	}
+
+	errOut := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(errPipe)
+		errOut <- b
+	}()
+
+	out, _ := io.ReadAll(outPipe)
+	if string(out) != "[Server thread/INFO]: Starting minecraft server\n[Server thread/INFO]: Done (1.0s)!\n" {
+		t.Errorf("unexpected stdout: %q", out)
+	}
+	if b := <-errOut; string(b) != "warning\n" {
+		t.Errorf("unexpected stderr: %q", b)
+	}
+
+	if _, err := inPipe.Write([]byte("stop\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-fd.stdin:
+		if line != "stop" {
+			t.Errorf("unexpected stdin: %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("command not received on container stdin")
+	}
+
+	// resume of a running container is not an error
+	if suspended, logMsh := d.resume(); logMsh != nil || suspended {
+		t.Errorf("resume of running container failed: %v", logMsh)
+	}
+	if suspended, logMsh := d.suspend(); logMsh != nil || !suspended || !fd.paused {
+		t.Errorf("container should be paused: %v", logMsh)
+	}
+	if suspended, logMsh := d.resume(); logMsh != nil || suspended || fd.paused {
+		t.Errorf("container should be unpaused: %v", logMsh)
+	}
+
+	if logMsh := d.kill(); logMsh != nil || !fd.killed {
+		t.Errorf("container should be killed: %v", logMsh)
+	}
+
+	if code := d.wait(); code != 137 {
+		t.Errorf("container exit code is %d (expected 137)", code)
+	}
+	inPipe.Close()
+}
+
+func Test_dockerDriver_notFound(t *testing.T) {
+	fd := newFakeDocker(t)
+	d := newDockerDriver(fd.socket, "missing")
+
+	_, _, _, logMsh := d.start()
+	if logMsh == nil {
+		t.Fatalf("start of missing container should fail")
+	}
+	if !strings.Contains(logMsh.Mex, "docker") {
+		t.Errorf("unexpected error: %s", logMsh.Mex)
+	}
+}
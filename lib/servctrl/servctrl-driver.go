@@ -0,0 +1,306 @@
+package servctrl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/opsys"
+)
+
+// serverDriver runs the minecraft server process and gives access to its console.
+// The driver is selected by Commands.Driver.
+type serverDriver interface {
+	// start starts ms and returns the pipes of its console
+	start() (outPipe, errPipe io.ReadCloser, inPipe io.WriteCloser, logMsh *errco.MshLog)
+	// wait waits for ms to exit and returns its exit code (-1: unknown or killed by a signal)
+	// (should be called after console output pipes are fully read)
+	wait() int
+	// suspend suspends ms (when succeeds returns: true, nil)
+	suspend() (bool, *errco.MshLog)
+	// resume resumes ms (when succeeds returns: false, nil)
+	resume() (bool, *errco.MshLog)
+	// kill kills ms (when succeeds returns nil)
+	kill() *errco.MshLog
+	// reclaim swaps out the memory of suspended ms (when succeeds returns: reclaimed bytes, nil)
+	reclaim() (uint64, *errco.MshLog)
+	// prefault loads back the swapped out memory of ms (when succeeds returns nil)
+	prefault() *errco.MshLog
+	// checkpoint checkpoints ms process to disk in dir and lets it exit (when succeeds returns nil)
+	checkpoint(dir string) *errco.MshLog
+	// restored returns true if the running ms process was restored from a checkpoint
+	restored() bool
+}
+
+// newServerDriver returns the server driver specified in config
+func newServerDriver(c *config.Configuration) (serverDriver, *errco.MshLog) {
+	switch c.Commands.Driver {
+	case "", config.DRIVER_EXEC:
+		return &execDriver{config: c}, nil
+	case config.DRIVER_DOCKER:
+		return newDockerDriver(c.Commands.DockerSocket, c.Commands.DockerContainer), nil
+	default:
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TERMINAL_START, "unknown server driver: %s", c.Commands.Driver)
+	}
+}
+
+// execDriver runs ms as a child process of msh.
+//
+// If Msh.SuspendCgroup is enabled (linux only), ms is placed in its own cgroup v2
+// that is used to suspend (cgroup freezer), kill and limit ms process tree.
+//
+// If Msh.CheckpointAllow is enabled (linux only), ms is restored from the last checkpoint when available.
+type execDriver struct {
+	config     *config.Configuration
+	cmd        *exec.Cmd
+	proc       *os.Process // ms process restored from checkpoint (nil: ms process is cmd.Process)
+	pid        uint32      // pid of ms process
+	cgroup     string      // cgroup v2 path of ms process tree (empty: process group signals are used)
+	isRestored bool        // ms process was restored from checkpoint
+}
+
+func (d *execDriver) start() (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.MshLog) {
+	d.proc = nil
+	d.isRestored = false
+
+	// restore ms from last checkpoint
+	// (on error, ms is cold started)
+	if d.config.Msh.CheckpointAllow {
+		if dir, meta, logMsh := lastCheckpoint(d.config); logMsh == nil {
+			outPipe, errPipe, inPipe, logMsh := d.restore(dir, meta)
+			if logMsh == nil {
+				return outPipe, errPipe, inPipe, nil
+			}
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CHECKPOINT, "could not restore minecraft server from checkpoint: cold starting it")
+		} else {
+			logMsh.Log(true)
+		}
+	}
+
+	// set terminal cmd
+	command, logMsh := d.config.BuildCommandStartServer()
+	if logMsh != nil {
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+	d.cmd = exec.Command(command[0], command[1:]...)
+	d.cmd.Dir = d.config.Server.Folder
+
+	// launch as new process group so that signals (ex: SIGINT) are sent to msh
+	// (not relayed to the java server child process)
+	d.cmd.SysProcAttr = opsys.NewProcGroupAttr()
+
+	// set terminal pipes
+	outPipe, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdoutPipe load: "+err.Error())
+	}
+	errPipe, err := d.cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StderrPipe load: "+err.Error())
+	}
+	inPipe, err := d.cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdinPipe load: "+err.Error())
+	}
+
+	err = d.cmd.Start()
+	if err != nil {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TERMINAL_START, err.Error())
+	}
+	d.pid = uint32(d.cmd.Process.Pid)
+
+	d.setupCgroup()
+
+	return outPipe, errPipe, inPipe, nil
+}
+
+// restore restores ms process from a checkpoint and returns the pipes of its console.
+// The checkpoint is marked as restored before restoring it (it must never be restored twice).
+func (d *execDriver) restore(dir string, meta *model.Checkpoint) (io.ReadCloser, io.ReadCloser, io.WriteCloser, *errco.MshLog) {
+	if len(meta.Pipes) != 3 {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CHECKPOINT, "checkpoint console pipes not found")
+	}
+
+	meta.Restored = true
+	logMsh := writeCheckpointMeta(dir, meta)
+	if logMsh != nil {
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+
+	// new console pipes replace the ones of the checkpointed process
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "stdin pipe load: "+err.Error())
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "stdout pipe load: "+err.Error())
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		outR.Close()
+		outW.Close()
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "stderr pipe load: "+err.Error())
+	}
+
+	logMsh = opsys.CriuRestore(dir, map[string]*os.File{meta.Pipes[0]: inR, meta.Pipes[1]: outW, meta.Pipes[2]: errW})
+
+	// ms process ends of the pipes are not used by msh
+	inR.Close()
+	outW.Close()
+	errW.Close()
+
+	if logMsh != nil {
+		inW.Close()
+		outR.Close()
+		errR.Close()
+		return nil, nil, nil, logMsh.AddTrace()
+	}
+
+	// restored process has the same pid it had when checkpointed
+	proc, err := os.FindProcess(int(meta.Pid))
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		errR.Close()
+		return nil, nil, nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_NOT_FOUND, err.Error())
+	}
+
+	d.cmd = nil
+	d.proc = proc
+	d.pid = meta.Pid
+	d.isRestored = true
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "restored minecraft server from checkpoint of %s", meta.Date.Format(time.RFC3339))
+
+	d.setupCgroup()
+
+	return outR, errR, inW, nil
+}
+
+// setupCgroup places ms in its own cgroup if Msh.SuspendCgroup is enabled
+// (on error, process group signals are used to suspend/kill ms)
+func (d *execDriver) setupCgroup() {
+	d.cgroup = ""
+	if d.config.Msh.SuspendCgroup {
+		logMsh := d.loadCgroup()
+		if logMsh != nil {
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CGROUP, "could not place minecraft server in its own cgroup: process signals will be used for suspension")
+		}
+	}
+}
+
+func (d *execDriver) wait() int {
+	var state *os.ProcessState
+
+	// wait process (to avoid defunct java server process)
+	if d.proc != nil {
+		state, _ = d.proc.Wait()
+	} else {
+		d.cmd.Wait()
+		state = d.cmd.ProcessState
+	}
+
+	if d.cgroup != "" {
+		if logMsh := opsys.CgroupRemove(d.cgroup); logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+
+	// restored ms process is not a child of msh: its exit code is unknown
+	if state == nil {
+		return -1
+	}
+
+	return state.ExitCode()
+}
+
+func (d *execDriver) suspend() (bool, *errco.MshLog) {
+	if d.cgroup != "" {
+		return opsys.CgroupFreeze(d.cgroup, true)
+	}
+
+	return opsys.ProcTreeSuspend(d.pid)
+}
+
+func (d *execDriver) resume() (bool, *errco.MshLog) {
+	if d.cgroup != "" {
+		return opsys.CgroupFreeze(d.cgroup, false)
+	}
+
+	return opsys.ProcTreeResume(d.pid)
+}
+
+func (d *execDriver) kill() *errco.MshLog {
+	if d.cgroup != "" {
+		// cgroup.kill is not available before linux 5.14
+		logMsh := opsys.CgroupKill(d.cgroup)
+		if logMsh == nil {
+			return nil
+		}
+		logMsh.Log(true)
+	}
+
+	return opsys.ProcTreeKill(d.pid)
+}
+
+func (d *execDriver) reclaim() (uint64, *errco.MshLog) {
+	return opsys.MemReclaim(d.cgroup, d.pid)
+}
+
+func (d *execDriver) prefault() *errco.MshLog {
+	return opsys.MemPrefault(d.cgroup, d.pid)
+}
+
+func (d *execDriver) checkpoint(dir string) *errco.MshLog {
+	// console pipes of ms process are replaced when restoring it
+	pipes, logMsh := opsys.ProcStdPipes(d.pid)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = writeCheckpointMeta(dir, &model.Checkpoint{Date: time.Now(), Pid: d.pid, Pipes: pipes})
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = opsys.CriuDump(d.pid, dir)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+func (d *execDriver) restored() bool {
+	return d.isRestored
+}
+
+// loadCgroup creates the cgroup of ms and moves ms process in it
+func (d *execDriver) loadCgroup() *errco.MshLog {
+	cgroup, logMsh := opsys.CgroupCreate(fmt.Sprintf("msh-server-%d", d.pid), d.config.Msh.CgroupMemoryMax, d.config.Msh.CgroupCpuMax)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	logMsh = opsys.CgroupAddProc(cgroup, d.pid)
+	if logMsh != nil {
+		opsys.CgroupRemove(cgroup)
+		return logMsh.AddTrace()
+	}
+
+	d.cgroup = cgroup
+
+	return nil
+}
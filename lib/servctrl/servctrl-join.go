@@ -0,0 +1,155 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+const (
+	// joinHistoryFileName is the file (in minecraft server folder) where the join history is stored
+	joinHistoryFileName string = "msh-join-history.json"
+
+	// joinHistoryLen is the number of records kept in join history
+	joinHistoryLen int = 5000
+
+	// joinHistoryAge is the max age of the records used to estimate the rejoin probability
+	joinHistoryAge time.Duration = 8 * 7 * 24 * time.Hour
+
+	// freezeBootWeight is the boot duration that counts as half of the missing rejoin probability
+	// (the longer the boot, the longer rejoining players wait if ms is frozen)
+	freezeBootWeight time.Duration = 5 * time.Minute
+)
+
+// loadJoinHistory loads the join history from file.
+// If the file does not exist the join history is left empty.
+func (s *Server) loadJoinHistory() {
+	data, err := os.ReadFile(filepath.Join(s.Config.Server.Folder, joinHistoryFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JOIN_HISTORY, "can't read join history file: %s", err.Error())
+		}
+		return
+	}
+
+	var history []model.JoinRecord
+	if err = json.Unmarshal(data, &history); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JOIN_HISTORY, "join history file format error: %s", err.Error())
+		return
+	}
+
+	s.joinM.Lock()
+	s.joinHistory = history
+	s.joinM.Unlock()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "join history loaded: %d records (%s)", len(history), s.Name)
+}
+
+// RecordJoin adds a player join to the join history (if FreezeAdaptive is enabled)
+func (s *Server) RecordJoin() {
+	s.recordJoinHistory(false)
+}
+
+// RecordEmpty adds the moment in which the last player left to the join history (if FreezeAdaptive is enabled)
+func (s *Server) RecordEmpty() {
+	s.recordJoinHistory(true)
+}
+
+// recordJoinHistory adds a record to the join history and saves the history to file
+func (s *Server) recordJoinHistory(empty bool) {
+	if !s.Config.Msh.FreezeAdaptive {
+		return
+	}
+
+	s.joinM.Lock()
+	s.joinHistory = append(s.joinHistory, model.JoinRecord{Date: time.Now(), Empty: empty})
+	if len(s.joinHistory) > joinHistoryLen {
+		s.joinHistory = s.joinHistory[len(s.joinHistory)-joinHistoryLen:]
+	}
+	data, err := json.Marshal(s.joinHistory)
+	s.joinM.Unlock()
+
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		return
+	}
+
+	err = os.WriteFile(filepath.Join(s.Config.Server.Folder, joinHistoryFileName), data, 0644)
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JOIN_HISTORY, "can't write join history file: %s", err.Error())
+	}
+}
+
+// freezeDelay returns the time to wait before the soft freeze of empty ms and the reason of the choice.
+//
+// If FreezeAdaptive is enabled, the delay is chosen between FreezeAdaptiveMin and FreezeAdaptiveMax
+// from the probability that a player rejoins soon (at the current hour of the week) and the boot estimate.
+// Otherwise TimeBeforeStoppingEmptyServer is returned.
+func (s *Server) freezeDelay() (time.Duration, string) {
+	if !s.Config.Msh.FreezeAdaptive {
+		return time.Duration(s.Config.Msh.TimeBeforeStoppingEmptyServer) * time.Second, "TimeBeforeStoppingEmptyServer"
+	}
+
+	min := time.Duration(s.Config.Msh.FreezeAdaptiveMin) * time.Second
+	max := time.Duration(s.Config.Msh.FreezeAdaptiveMax) * time.Second
+
+	now := time.Now()
+
+	s.joinM.Lock()
+	p, samples := rejoinProbability(s.joinHistory, now, max)
+	s.joinM.Unlock()
+
+	// slow boots increase the probability of keeping ms warm
+	pBoot := p + (1-p)*float64(s.Stats.BootEstimate)/float64(s.Stats.BootEstimate+freezeBootWeight)
+
+	delay := (min + time.Duration(pBoot*float64(max-min))).Round(time.Second)
+	reason := fmt.Sprintf("rejoin probability %.0f%% on %s %02d:00 (%d samples), boot estimate %s", p*100, now.Weekday(), now.Hour(), samples, s.Stats.BootEstimate)
+
+	return delay, reason
+}
+
+// rejoinProbability returns the probability that a player joins within horizon after ms gets empty
+// at the same hour of the week of t, and the number of samples used.
+//
+// The probability is smoothed (with no samples it's 50%) and records older than joinHistoryAge are ignored.
+func rejoinProbability(history []model.JoinRecord, t time.Time, horizon time.Duration) (float64, int) {
+	slot := hourOfWeek(t)
+	samples, rejoined := 0, 0
+
+	for i, r := range history {
+		if !r.Empty || t.Sub(r.Date) > joinHistoryAge || hourOfWeek(r.Date) != slot {
+			continue
+		}
+
+		// a sample that has not reached the horizon yet can't be evaluated
+		if t.Sub(r.Date) < horizon {
+			continue
+		}
+
+		samples++
+
+		// history is sorted by date
+		for _, next := range history[i+1:] {
+			if next.Date.Sub(r.Date) > horizon {
+				break
+			}
+			if !next.Empty {
+				rejoined++
+				break
+			}
+		}
+	}
+
+	return float64(rejoined+1) / float64(samples+2), samples
+}
+
+// hourOfWeek returns the hour of the week of t (0: sunday 00:00-00:59, local time)
+func hourOfWeek(t time.Time) int {
+	t = t.Local()
+	return int(t.Weekday())*24 + t.Hour()
+}
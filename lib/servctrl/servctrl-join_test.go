@@ -0,0 +1,67 @@
+package servctrl
+
+import (
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/model"
+	"msh/lib/servstats"
+)
+
+func Test_rejoinProbability(t *testing.T) {
+	now := time.Date(2024, time.January, 29, 20, 30, 0, 0, time.Local) // monday
+	horizon := 30 * time.Minute
+
+	// weeks ago, at the same hour of the week: ms got empty, then a player rejoined after minutes
+	history := []model.JoinRecord{}
+	for w := 4; w >= 1; w-- {
+		empty := now.Add(-time.Duration(w) * 7 * 24 * time.Hour)
+		history = append(history, model.JoinRecord{Date: empty, Empty: true})
+		if w != 4 {
+			history = append(history, model.JoinRecord{Date: empty.Add(time.Duration(w) * 5 * time.Minute), Empty: false})
+		}
+	}
+	// other hours of the week are ignored
+	history = append(history, model.JoinRecord{Date: now.Add(-3 * time.Hour), Empty: true})
+
+	p, samples := rejoinProbability(history, now, horizon)
+	if samples != 4 || p != 4.0/6.0 {
+		t.Errorf("rejoin probability is %f with %d samples (expected %f with 4 samples)", p, samples, 4.0/6.0)
+	}
+
+	// no samples
+	if p, samples := rejoinProbability([]model.JoinRecord{}, now, horizon); samples != 0 || p != 0.5 {
+		t.Errorf("rejoin probability without history is %f (expected 0.5)", p)
+	}
+
+	// rejoin after the horizon is not counted
+	p, _ = rejoinProbability(history, now, 8*time.Minute)
+	if p != 2.0/6.0 {
+		t.Errorf("rejoin probability is %f (expected %f)", p, 2.0/6.0)
+	}
+}
+
+func Test_freezeDelay(t *testing.T) {
+	s := &Server{Name: "test", Config: &config.Configuration{}, Stats: servstats.NewStats()}
+	s.Config.Msh.TimeBeforeStoppingEmptyServer = 30
+
+	if d, _ := s.freezeDelay(); d != 30*time.Second {
+		t.Errorf("freeze delay is %s (expected 30s)", d)
+	}
+
+	s.Config.Msh.FreezeAdaptive = true
+	s.Config.Msh.FreezeAdaptiveMin = 60
+	s.Config.Msh.FreezeAdaptiveMax = 660
+
+	// no history: 50% probability
+	if d, _ := s.freezeDelay(); d != 360*time.Second {
+		t.Errorf("freeze delay is %s (expected 6m0s)", d)
+	}
+
+	// slow boot keeps ms warm longer
+	s.Stats.BootEstimate = freezeBootWeight
+	if d, _ := s.freezeDelay(); d != 510*time.Second {
+		t.Errorf("freeze delay is %s (expected 8m30s)", d)
+	}
+}
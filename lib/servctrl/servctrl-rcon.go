@@ -0,0 +1,248 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - wiki.vg/RCON
+// - developer.valvesoftware.com/wiki/Source_RCON_Protocol
+
+// rcon packet types
+const (
+	RCON_TYPE_RESPONSE int32 = 0 // response to a command
+	RCON_TYPE_COMMAND  int32 = 2 // command request (also sent by the server as auth response)
+	RCON_TYPE_LOGIN    int32 = 3 // login request
+)
+
+const (
+	rconTimeout   time.Duration = 10 * time.Second // timeout of a rcon request
+	rconMaxPacket int32         = 4096 + 10        // max length of a packet sent by the server (payload of 4096 bytes)
+	rconMaxBody   int           = 1446             // max length of a command sent to the server
+)
+
+// rconClient is a minecraft server remote console client.
+// Requests are sent one at a time on the same connection so that each response is matched to its request.
+type rconClient struct {
+	m     sync.Mutex
+	conn  net.Conn
+	reqID int32
+}
+
+// rconExecute executes a command on ms using rcon (rcon.port and rcon.password from server.properties)
+// and returns the full command response.
+func (s *Server) rconExecute(command string) (string, *errco.MshLog) {
+	enabled, logMsh := s.Config.ParsePropertiesBool("enable-rcon")
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+	if !enabled {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, "rcon is not enabled in server.properties (enable-rcon=false)")
+	}
+
+	port, logMsh := s.Config.ParsePropertiesInt("rcon.port")
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	password, logMsh := s.Config.ParsePropertiesString("rcon.password")
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	out, logMsh := s.rcon.execute(net.JoinHostPort(s.Config.ServHost, strconv.Itoa(port)), password, command)
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	return out, nil
+}
+
+// execute sends the command to the rcon server at address and returns the response.
+// The connection is opened (and authenticated) if needed and closed on error.
+func (rc *rconClient) execute(address, password, command string) (string, *errco.MshLog) {
+	if len(command) > rconMaxBody {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, "rcon command too long (%d > %d bytes)", len(command), rconMaxBody)
+	}
+
+	rc.m.Lock()
+	defer rc.m.Unlock()
+
+	if rc.conn == nil {
+		logMsh := rc.connect(address, password)
+		if logMsh != nil {
+			return "", logMsh.AddTrace()
+		}
+	}
+
+	out, logMsh := rc.request(command)
+	if logMsh != nil {
+		rc.closeConn()
+		return out, logMsh.AddTrace()
+	}
+
+	return out, nil
+}
+
+// close closes the rcon connection (if open)
+func (rc *rconClient) close() {
+	rc.m.Lock()
+	defer rc.m.Unlock()
+
+	rc.closeConn()
+}
+
+// connect opens and authenticates the rcon connection
+func (rc *rconClient) connect(address, password string) *errco.MshLog {
+	conn, err := net.DialTimeout("tcp", address, rconTimeout)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON_DIAL, err.Error())
+	}
+	rc.conn = conn
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "rcon connected to %s", address)
+
+	rc.conn.SetDeadline(time.Now().Add(rconTimeout))
+
+	id := rc.nextID()
+	logMsh := rc.write(id, RCON_TYPE_LOGIN, password)
+	if logMsh != nil {
+		rc.closeConn()
+		return logMsh.AddTrace()
+	}
+
+	// the server answers to the login request with an auth response (request id -1 if the password is wrong)
+	for {
+		respID, respType, _, logMsh := rc.read()
+		if logMsh != nil {
+			rc.closeConn()
+			return logMsh.AddTrace()
+		}
+
+		if respType != RCON_TYPE_COMMAND {
+			continue
+		}
+
+		if respID != id {
+			rc.closeConn()
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON_AUTH, "rcon authentication failed (check rcon.password)")
+		}
+
+		return nil
+	}
+}
+
+// request sends a command on the authenticated connection and returns the response.
+//
+// Long responses are split by the server in multiple packets: when the first packet is received, a second (invalid)
+// request is sent so that the end of the response is detected when the server answers to it.
+//
+// If the server closes the connection after responding (ex: stop command), the response received is returned.
+func (rc *rconClient) request(command string) (string, *errco.MshLog) {
+	rc.conn.SetDeadline(time.Now().Add(rconTimeout))
+
+	id := rc.nextID()
+	if logMsh := rc.write(id, RCON_TYPE_COMMAND, command); logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	var out strings.Builder
+	var endID int32 = 0
+
+	for {
+		respID, _, body, logMsh := rc.read()
+		if logMsh != nil {
+			if endID != 0 {
+				rc.closeConn()
+				return out.String(), nil
+			}
+			return "", logMsh.AddTrace()
+		}
+
+		switch {
+		case respID == id:
+			out.WriteString(body)
+
+			if endID == 0 {
+				endID = rc.nextID()
+				if logMsh := rc.write(endID, RCON_TYPE_RESPONSE, ""); logMsh != nil {
+					rc.closeConn()
+					return out.String(), nil
+				}
+			}
+
+		case respID == endID && endID != 0:
+			return out.String(), nil
+		}
+	}
+}
+
+// write writes a rcon packet
+func (rc *rconClient) write(id, typ int32, body string) *errco.MshLog {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(4+4+len(body)+2))
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, typ)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	_, err := rc.conn.Write(buf.Bytes())
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, err.Error())
+	}
+
+	return nil
+}
+
+// read reads a rcon packet and returns its request id, type and body
+func (rc *rconClient) read() (int32, int32, string, *errco.MshLog) {
+	var length int32
+	err := binary.Read(rc.conn, binary.LittleEndian, &length)
+	if err == io.EOF {
+		return 0, 0, "", errco.NewLog(errco.TYPE_WAR, errco.LVL_2, errco.ERROR_CONN_EOF, "rcon connection closed by server")
+	} else if err != nil {
+		return 0, 0, "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, err.Error())
+	}
+	if length < 10 || length > rconMaxPacket {
+		return 0, 0, "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, "rcon packet length not valid (%d)", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rc.conn, data); err != nil {
+		return 0, 0, "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_RCON, err.Error())
+	}
+
+	id := int32(binary.LittleEndian.Uint32(data[0:4]))
+	typ := int32(binary.LittleEndian.Uint32(data[4:8]))
+	body := string(bytes.TrimRight(data[8:], "\x00"))
+
+	return id, typ, body, nil
+}
+
+// nextID returns a new request id (always positive as -1 is reserved for auth failure)
+func (rc *rconClient) nextID() int32 {
+	rc.reqID++
+	if rc.reqID <= 0 {
+		rc.reqID = 1
+	}
+	return rc.reqID
+}
+
+// closeConn closes the rcon connection without locking
+func (rc *rconClient) closeConn() {
+	if rc.conn == nil {
+		return
+	}
+
+	rc.conn.Close()
+	rc.conn = nil
+}
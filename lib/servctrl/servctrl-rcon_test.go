@@ -0,0 +1,152 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"msh/lib/errco"
+)
+
+// fakeRcon is a minimal minecraft rcon server (responses longer than 4096 bytes are split in multiple packets)
+func fakeRcon(t *testing.T, password string, responses map[string]string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(conn net.Conn, id, typ int32, body string) {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, int32(10+len(body)))
+		binary.Write(&buf, binary.LittleEndian, id)
+		binary.Write(&buf, binary.LittleEndian, typ)
+		buf.WriteString(body)
+		buf.Write([]byte{0, 0})
+		conn.Write(buf.Bytes())
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				authenticated := false
+
+				for {
+					var length int32
+					if err := binary.Read(conn, binary.LittleEndian, &length); err != nil {
+						return
+					}
+					data := make([]byte, length)
+					if _, err := io.ReadFull(conn, data); err != nil {
+						return
+					}
+					id := int32(binary.LittleEndian.Uint32(data[0:4]))
+					typ := int32(binary.LittleEndian.Uint32(data[4:8]))
+					body := string(bytes.TrimRight(data[8:], "\x00"))
+
+					switch {
+					case typ == RCON_TYPE_LOGIN && body == password:
+						authenticated = true
+						write(conn, id, RCON_TYPE_COMMAND, "")
+					case typ == RCON_TYPE_LOGIN:
+						write(conn, -1, RCON_TYPE_COMMAND, "")
+						return
+					case !authenticated:
+						return
+					case typ == RCON_TYPE_COMMAND:
+						resp := responses[body]
+						for len(resp) > 4096 {
+							write(conn, id, RCON_TYPE_RESPONSE, resp[:4096])
+							resp = resp[4096:]
+						}
+						write(conn, id, RCON_TYPE_RESPONSE, resp)
+						if body == "stop" {
+							return
+						}
+					default:
+						write(conn, id, RCON_TYPE_RESPONSE, "Unknown request 0")
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func Test_rconClient(t *testing.T) {
+	long := strings.Repeat("a", 10000)
+	l := fakeRcon(t, "secret", map[string]string{
+		"list": "There are 0 of a max of 20 players online: ",
+		"long": long,
+		"stop": "Stopping the server",
+	})
+	defer l.Close()
+
+	rc := &rconClient{}
+	defer rc.close()
+
+	out, logMsh := rc.execute(l.Addr().String(), "secret", "list")
+	if logMsh != nil {
+		t.Fatalf("list: %s", logMsh.Mex)
+	}
+	if out != "There are 0 of a max of 20 players online: " {
+		t.Fatalf("unexpected list output: %q", out)
+	}
+	if n, logMsh := searchListCom("[Rcon INFO]: " + out); logMsh != nil || n != 0 {
+		t.Fatalf("unexpected player count from rcon output: %d", n)
+	}
+
+	// multi-packet response
+	out, logMsh = rc.execute(l.Addr().String(), "secret", "long")
+	if logMsh != nil {
+		t.Fatalf("long: %s", logMsh.Mex)
+	}
+	if out != long {
+		t.Fatalf("unexpected long output length: %d", len(out))
+	}
+
+	// command with no output
+	out, logMsh = rc.execute(l.Addr().String(), "secret", "say hi")
+	if logMsh != nil || out != "" {
+		t.Fatalf("unexpected say output: %q", out)
+	}
+
+	// server closes the connection after responding
+	out, logMsh = rc.execute(l.Addr().String(), "secret", "stop")
+	if logMsh != nil {
+		t.Fatalf("stop: %s", logMsh.Mex)
+	}
+	if out != "Stopping the server" {
+		t.Fatalf("unexpected stop output: %q", out)
+	}
+
+	// connection is opened again after being closed
+	if _, logMsh = rc.execute(l.Addr().String(), "secret", "list"); logMsh != nil {
+		t.Fatalf("list after reconnection: %s", logMsh.Mex)
+	}
+}
+
+func Test_rconClientAuth(t *testing.T) {
+	l := fakeRcon(t, "secret", map[string]string{})
+	defer l.Close()
+
+	rc := &rconClient{}
+	defer rc.close()
+
+	_, logMsh := rc.execute(l.Addr().String(), "wrong", "list")
+	if logMsh == nil || logMsh.Cod != errco.ERROR_RCON_AUTH {
+		t.Fatalf("expected rcon authentication error, got %v", logMsh)
+	}
+	if rc.conn != nil {
+		t.Fatalf("connection not closed after authentication failure")
+	}
+}
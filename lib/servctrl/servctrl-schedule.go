@@ -0,0 +1,301 @@
+package servctrl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// schedule types
+const (
+	SCHEDULE_WARM      string = "warm"      // ms is kept warm during the window
+	SCHEDULE_HIBERNATE string = "hibernate" // ms is stopped and can't be woken during the window
+)
+
+const (
+	scheduleCheckInterval    time.Duration = 30 * time.Second                    // time between two checks of the schedules
+	scheduleMessageHibernate string        = "Server is hibernating by schedule" // default message of hibernate windows
+)
+
+// schedule is a config schedule with its parsed cron expression
+type schedule struct {
+	model.Schedule
+	cron *cronExpr
+}
+
+// cronExpr is a parsed cron expression.
+// Each field is a bitmask of the allowed values.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // day-of-month/day-of-week field is "*"
+}
+
+// loadSchedules parses the schedules specified in config.
+// Invalid schedules are logged and ignored.
+func (s *Server) loadSchedules() {
+	s.schedules = []*schedule{}
+
+	for _, sc := range s.Config.Schedules {
+		parsed, logMsh := parseSchedule(sc)
+		if logMsh != nil {
+			logMsh.Log(true)
+			continue
+		}
+		s.schedules = append(s.schedules, parsed)
+	}
+
+	if len(s.schedules) > 0 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loaded %d schedules (%s)", len(s.schedules), s.Name)
+	}
+}
+
+// ScheduleHibernation returns the message of the active hibernate window.
+// If no hibernate window is active returns: "", false
+func (s *Server) ScheduleHibernation() (string, bool) {
+	now := time.Now()
+
+	for _, sc := range s.schedules {
+		if sc.Type == SCHEDULE_HIBERNATE && sc.active(now) {
+			if sc.Message == "" {
+				return scheduleMessageHibernate, true
+			}
+			return sc.Message, true
+		}
+	}
+
+	return "", false
+}
+
+// scheduleWarm returns true if a warm window (or its pre-warm time) is active
+func (s *Server) scheduleWarm() bool {
+	now := time.Now()
+
+	for _, sc := range s.schedules {
+		if sc.Type == SCHEDULE_WARM && sc.active(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scheduleWatch warms/freezes ms according to the active schedule windows.
+// Hibernate windows have priority over warm windows.
+//
+// If no schedule is loaded this func just returns.
+//
+// [goroutine]
+func (s *Server) scheduleWatch() {
+	if len(s.schedules) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+
+	for range ticker.C {
+		if s.Stats.MajorError != nil {
+			continue
+		}
+
+		if message, hibernating := s.ScheduleHibernation(); hibernating {
+			if s.Stats.Status != errco.SERVER_STATUS_ONLINE && s.Stats.Status != errco.SERVER_STATUS_STARTING && s.Stats.Status != errco.SERVER_STATUS_SUSPENDED {
+				continue
+			}
+
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "schedule will freeze minecraft server: %s (%s)", message, s.Name)
+
+			logMsh := s.scheduleFreeze(message)
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+
+			continue
+		}
+
+		if s.scheduleWarm() && (s.Stats.Status == errco.SERVER_STATUS_OFFLINE || s.Stats.Status == errco.SERVER_STATUS_SUSPENDED || s.Stats.Suspended) {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "schedule will warm minecraft server (%s)", s.Name)
+
+			logMsh := s.WarmMS()
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+		}
+	}
+}
+
+// scheduleFreeze warns players and force freezes ms after the freeze countdown (resuming it first if suspended)
+func (s *Server) scheduleFreeze(message string) *errco.MshLog {
+	var logMsh *errco.MshLog
+
+	// suspended ms must be resumed to be stopped
+	if s.Stats.Status == errco.SERVER_STATUS_SUSPENDED {
+		s.Stats.Suspended, logMsh = s.procResume()
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		s.Stats.Status = errco.SERVER_STATUS_ONLINE
+	}
+
+	if s.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		// players are warned, ignore errors
+		_ = s.TellRaw("schedule", message, "scheduleFreeze")
+	}
+
+	// players can't postpone a scheduled hibernation
+	logMsh = s.FreezeMSCountdown(false)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// parseSchedule checks a config schedule and parses its cron expression
+func parseSchedule(sc model.Schedule) (*schedule, *errco.MshLog) {
+	if sc.Type != SCHEDULE_WARM && sc.Type != SCHEDULE_HIBERNATE {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "schedule type \"%s\" is invalid (must be \"%s\" or \"%s\")", sc.Type, SCHEDULE_WARM, SCHEDULE_HIBERNATE)
+	}
+	if sc.Duration <= 0 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "schedule duration must be > 0 (cron \"%s\")", sc.Cron)
+	}
+	if sc.PreWarm < 0 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "schedule pre-warm must be >= 0 (cron \"%s\")", sc.Cron)
+	}
+
+	cron, logMsh := parseCron(sc.Cron)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	return &schedule{Schedule: sc, cron: cron}, nil
+}
+
+// active returns true if t is inside the window of the schedule
+// (for warm windows, the pre-warm time before the window is included).
+func (sc *schedule) active(t time.Time) bool {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+
+	preWarm := 0
+	if sc.Type == SCHEDULE_WARM {
+		preWarm = sc.PreWarm
+	}
+
+	// t is inside the window if a window started in the last Duration minutes (or starts in the next preWarm minutes)
+	for m := -preWarm; m < sc.Duration; m++ {
+		if sc.cron.match(t.Add(-time.Duration(m) * time.Minute)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCron parses a cron expression with 5 fields: "minute hour day-of-month month day-of-week".
+// Fields support "*", values, ranges ("1-5"), lists ("1,3") and steps ("*/15", "0-30/10").
+// Day-of-week is 0-6 (sunday is 0 or 7).
+func parseCron(expr string) (*cronExpr, *errco.MshLog) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "cron expression \"%s\" must have 5 fields", expr)
+	}
+
+	var c *cronExpr = &cronExpr{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var logMsh *errco.MshLog
+
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+
+	for i, b := range bounds {
+		*b.field, logMsh = parseCronField(fields[i], b.min, b.max)
+		if logMsh != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "cron expression \"%s\": %s", expr, fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+		}
+	}
+
+	// sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	return c, nil
+}
+
+// parseCronField parses a cron field into a bitmask of the allowed values
+func parseCronField(field string, min, max int) (uint64, *errco.MshLog) {
+	var mask uint64 = 0
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "invalid step \"%s\"", part)
+			}
+		}
+
+		start, end := min, max
+		if rng != "*" {
+			startStr, endStr, isRange := strings.Cut(rng, "-")
+
+			var err error
+			start, err = strconv.Atoi(startStr)
+			if err != nil {
+				return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "invalid value \"%s\"", part)
+			}
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(endStr)
+				if err != nil {
+					return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "invalid range \"%s\"", part)
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to max every 15
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SCHEDULE_PARSE, "\"%s\" out of range %d-%d", part, min, max)
+		}
+
+		for v := start; v <= end; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+
+	return mask, nil
+}
+
+// match returns true if the minute of t matches the cron expression.
+//
+// As in standard cron, if both day-of-month and day-of-week are restricted,
+// t matches if either of them matches.
+func (c *cronExpr) match(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if !c.domAny && !c.dowAny {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
@@ -0,0 +1,88 @@
+package servctrl
+
+import (
+	"testing"
+	"time"
+
+	"msh/lib/model"
+)
+
+func Test_parseCron(t *testing.T) {
+	// 2024-01-01 is a monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		expr   string
+		t      time.Time
+		expect bool
+	}{
+		{"* * * * *", at(1, 3, 17), true},
+		{"0 18 * * 1-5", at(1, 18, 0), true},
+		{"0 18 * * 1-5", at(6, 18, 0), false},  // saturday
+		{"*/15 * * * *", at(1, 3, 45), true},   // step
+		{"*/15 * * * *", at(1, 3, 46), false},  // step
+		{"0 3 * * 0", at(7, 3, 0), true},       // sunday as 0
+		{"0 3 * * 7", at(7, 3, 0), true},       // sunday as 7
+		{"0 3 15 * 1", at(1, 3, 0), true},      // day-of-month or day-of-week
+		{"0 3 15 * 1", at(2, 3, 0), false},     // day-of-month or day-of-week
+		{"30 8,20 * 1 *", at(3, 20, 30), true}, // list
+	}
+
+	for _, test := range tests {
+		c, logMsh := parseCron(test.expr)
+		if logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		if m := c.match(test.t); m != test.expect {
+			t.Errorf("cron \"%s\" match of %s is %t (expected %t)", test.expr, test.t, m, test.expect)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "a * * * *"} {
+		if _, logMsh := parseCron(expr); logMsh == nil {
+			t.Errorf("cron \"%s\" should be invalid", expr)
+		}
+	}
+}
+
+func Test_scheduleActive(t *testing.T) {
+	warm, logMsh := parseSchedule(model.Schedule{Type: SCHEDULE_WARM, Cron: "0 18 * * 1-5", Duration: 300, PreWarm: 10})
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	hibernate, logMsh := parseSchedule(model.Schedule{Type: SCHEDULE_HIBERNATE, Cron: "0 3 * * *", Duration: 180, PreWarm: 10})
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 30, 0, time.Local)
+	}
+
+	tests := []struct {
+		sc     *schedule
+		t      time.Time
+		expect bool
+	}{
+		{warm, at(17, 49), false},
+		{warm, at(17, 50), true}, // pre-warm
+		{warm, at(22, 59), true},
+		{warm, at(23, 0), false},
+		{hibernate, at(2, 55), false}, // pre-warm is ignored for hibernate windows
+		{hibernate, at(3, 0), true},
+		{hibernate, at(5, 59), true},
+		{hibernate, at(6, 0), false},
+	}
+
+	for _, test := range tests {
+		if a := test.sc.active(test.t); a != test.expect {
+			t.Errorf("%s window \"%s\" active at %s is %t (expected %t)", test.sc.Type, test.sc.Cron, test.t.Format("15:04"), a, test.expect)
+		}
+	}
+
+	if _, logMsh := parseSchedule(model.Schedule{Type: "sleep", Cron: "* * * * *", Duration: 1}); logMsh == nil {
+		t.Errorf("schedule type should be invalid")
+	}
+}
@@ -0,0 +1,145 @@
+package servctrl
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+// Server represents a minecraft server managed by msh.
+//
+// Each server has its own config, stats and terminal so that it can be warmed/frozen independently.
+type Server struct {
+	Name          string                 // name used in logs to identify the minecraft server
+	Hostnames     []string               // server addresses routed to this minecraft server (empty for the default one)
+	ConfigDefault *config.Configuration  // parameters of minecraft server config in file
+	Config        *config.Configuration  // parameters of minecraft server config in runtime
+	Stats         *servstats.ServerStats // info relative to minecraft server
+	Term          *servTerminal          // minecraft server terminal
+	lastOut       chan string            // used to communicate the last line got from the printer function
+	bootHistory   []model.BootRecord     // durations of previous boots (oldest first)
+	rcon          rconClient             // minecraft server remote console (used if Commands.Rcon is enabled)
+	schedules     []*schedule            // warm/hibernate windows loaded from config schedules
+	joinHistory   []model.JoinRecord     // player joins and moments in which ms got empty (oldest first)
+	joinM         sync.Mutex             // protects joinHistory
+	stayUntil     time.Time              // hibernation is postponed until this time (by Msh.StayCommand)
+	stayC         chan string            // notifies the running freeze countdown of a stay command (nil: no countdown)
+	stayM         sync.Mutex             // protects stayUntil and stayC
+	backingUp     atomic.Bool            // world backup is in progress (ms can't be woken)
+	crashes       int                    // consecutive crashes of ms (reset when ms exits normally)
+	crashLoop     bool                   // ms kept crashing after being restarted (it's not restarted anymore)
+	crashM        sync.Mutex             // protects crashes and crashLoop
+}
+
+// Default is the minecraft server to which clients are routed when no route matches the requested server address
+var Default *Server = &Server{
+	Name:          "default",
+	Hostnames:     []string{},
+	ConfigDefault: config.ConfigDefault,
+	Config:        config.ConfigRuntime,
+	Stats:         servstats.Stats,
+	Term:          ServTerm,
+	lastOut:       lastOut,
+}
+
+// servers contains the minecraft servers loaded from config routes (Default excluded)
+var servers []*Server = []*Server{}
+
+// LoadServers loads the minecraft servers specified in config routes.
+// Should be called after config has been loaded.
+func LoadServers() {
+	Default.loadStatusCache()
+	Default.loadBootHistory()
+	Default.loadJoinHistory()
+	Default.loadSchedules()
+	if Default.Config.Commands.Attach {
+		go Default.attachWatch()
+	}
+	go Default.scheduleWatch()
+
+	servers = []*Server{}
+
+	for _, r := range config.Routes {
+		s := &Server{
+			Name:          r.Hostnames[0],
+			Hostnames:     r.Hostnames,
+			ConfigDefault: r.ConfigDefault,
+			Config:        r.ConfigRuntime,
+			Stats:         r.Stats,
+			Term:          &servTerminal{IsActive: false},
+			lastOut:       make(chan string),
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "route %v --> %s:%d", s.Hostnames, s.Config.ServHost, s.Config.ServPort)
+
+		s.loadStatusCache()
+		s.loadBootHistory()
+		s.loadJoinHistory()
+		s.loadSchedules()
+		if s.Config.Commands.Attach {
+			go s.attachWatch()
+		}
+		go s.scheduleWatch()
+
+		servers = append(servers, s)
+	}
+
+	loadCgroups()
+}
+
+// loadCgroups prepares msh cgroup if a minecraft server is placed in its own cgroup with limits.
+// Controllers are enabled before any ms process is spawned, so that limits are applied since the first start.
+func loadCgroups() {
+	for _, s := range Servers() {
+		if !s.Config.Msh.SuspendCgroup || s.Config.Commands.Attach || s.Config.Commands.Driver == config.DRIVER_DOCKER {
+			continue
+		}
+		if s.Config.Msh.CgroupMemoryMax <= 0 && s.Config.Msh.CgroupCpuMax <= 0 {
+			continue
+		}
+
+		if logMsh := opsys.CgroupSetup(true); logMsh != nil {
+			logMsh.Log(true)
+		}
+		return
+	}
+}
+
+// Servers returns all minecraft servers managed by msh (Default is the first one)
+func Servers() []*Server {
+	return append([]*Server{Default}, servers...)
+}
+
+// Route returns the minecraft server to which the server address requested by a client is routed.
+// If no route matches the server address, Default is returned.
+func Route(hostname string) *Server {
+	hostname = config.NormalizeHostname(hostname)
+
+	for _, s := range servers {
+		for _, h := range s.Hostnames {
+			if h == hostname {
+				return s
+			}
+		}
+	}
+
+	return Default
+}
+
+// ServerByName returns the minecraft server with the specified name.
+// If not found returns nil.
+func ServerByName(name string) *Server {
+	for _, s := range Servers() {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
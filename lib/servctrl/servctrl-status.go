@@ -0,0 +1,55 @@
+package servctrl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"msh/lib/errco"
+)
+
+// statusCacheFileName is the file (in minecraft server folder) where the last status received from ms is stored
+const statusCacheFileName string = "msh-status-cache.json"
+
+// loadStatusCache loads the last status received from ms from file.
+// If the file does not exist the status cache is left empty.
+func (s *Server) loadStatusCache() {
+	data, err := os.ReadFile(filepath.Join(s.Config.Server.Folder, statusCacheFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_STATUS_CACHE, "can't read status cache file: %s", err.Error())
+		}
+		return
+	}
+
+	s.Stats.StatusCache = data
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "status cache loaded (%s)", s.Name)
+}
+
+// saveStatusCache stores the status received from ms and, if it changed, saves it to file
+func (s *Server) saveStatusCache(data []byte) *errco.MshLog {
+	if bytes.Equal(data, s.Stats.StatusCache) {
+		return nil
+	}
+
+	s.Stats.StatusCache = data
+
+	err := os.WriteFile(filepath.Join(s.Config.Server.Folder, statusCacheFileName), data, 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_STATUS_CACHE, "can't write status cache file: %s", err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "status cache updated (%s)", s.Name)
+
+	return nil
+}
+
+// refreshStatusCache requests server info to ms so that the status cache is updated
+// [goroutine]
+func (s *Server) refreshStatusCache() {
+	_, logMsh := s.getServInfo()
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+}
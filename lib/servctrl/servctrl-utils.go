@@ -2,8 +2,8 @@ package servctrl
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
-	"fmt"
 	"math/big"
 	"net"
 	"regexp"
@@ -14,7 +14,7 @@ import (
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/model"
-	"msh/lib/servstats"
+	"msh/lib/utility"
 )
 
 // countPlayerSafe returns the number of players on the server.
@@ -25,28 +25,28 @@ import (
 //
 // no error is returned: the return integer is always meaningful
 // (might be more or less reliable depending from where it retrieved).
-func countPlayerSafe() int {
+func (s *Server) countPlayerSafe() int {
 	var logMsh *errco.MshLog
 	var playerCount int
 	var method string
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "retrieving player count...")
 
-	if playerCount, logMsh = getPlayersByServInfo(); logMsh.Log(true) == nil {
+	if playerCount, logMsh = s.getPlayersByServInfo(); logMsh.Log(true) == nil {
 		method = "server info"
-		if playerCount != servstats.Stats.ConnCount {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", servstats.Stats.ConnCount, method, playerCount)
+		if playerCount != s.Stats.ConnCount {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", s.Stats.ConnCount, method, playerCount)
 		}
 
-	} else if playerCount, logMsh = getPlayersByListCom(); logMsh.Log(true) == nil {
+	} else if playerCount, logMsh = s.getPlayersByListCom(); logMsh.Log(true) == nil {
 		method = "list command"
-		if playerCount != servstats.Stats.ConnCount {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", servstats.Stats.ConnCount, method, playerCount)
+		if playerCount != s.Stats.ConnCount {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", s.Stats.ConnCount, method, playerCount)
 		}
 
 	} else {
 		method = "connection count"
-		playerCount = servstats.Stats.ConnCount
+		playerCount = s.Stats.ConnCount
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%d online players - method for player count: %s", playerCount, method)
@@ -55,18 +55,23 @@ func countPlayerSafe() int {
 }
 
 // getPlayersByListCom returns the number of players using "list" command
-func getPlayersByListCom() (int, *errco.MshLog) {
+func (s *Server) getPlayersByListCom() (int, *errco.MshLog) {
 	// Use configurable list command from config
-	listCommand := config.ConfigRuntime.Commands.ListCommand
+	listCommand := s.Config.Commands.ListCommand
 	if listCommand == "" {
 		// Default fallback if not configured
 		listCommand = "list"
 	}
-	output, logMsh := Execute(listCommand)
+	output, logMsh := s.Execute(listCommand)
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
 
+	// rcon responses don't contain the log header
+	if s.Config.Commands.Rcon {
+		output = "[Rcon INFO]: " + output
+	}
+
 	playerCount, logMsh := searchListCom(output)
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
@@ -99,8 +104,8 @@ func searchListCom(s string) (int, *errco.MshLog) {
 }
 
 // getPlayersByServInfo returns the number of players using server info request
-func getPlayersByServInfo() (int, *errco.MshLog) {
-	servInfo, logMsh := getServInfo()
+func (s *Server) getPlayersByServInfo() (int, *errco.MshLog) {
+	servInfo, logMsh := s.getServInfo()
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
@@ -109,24 +114,30 @@ func getPlayersByServInfo() (int, *errco.MshLog) {
 }
 
 // getServInfo returns server info after emulating a server info request to the minecraft server
-func getServInfo() (*model.DataInfo, *errco.MshLog) {
+func (s *Server) getServInfo() (*model.DataInfo, *errco.MshLog) {
 	var recInfoData []byte = []byte{}
 	var recInfo *model.DataInfo = &model.DataInfo{}
 	var buf []byte = make([]byte, 1024)
 
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := s.CheckMSWarm()
 	if logMsh != nil {
 		return nil, logMsh.AddTrace()
 	}
 
 	// open connection to minecraft server
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(s.Config.ServHost, strconv.Itoa(s.Config.ServPort)))
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 	}
 	defer serverSocket.Close()
 
+	// ms expects a PROXY protocol header on every connection
+	// (LOCAL command: connection is initiated by msh itself)
+	if s.Config.Msh.SendProxyProtocol {
+		serverSocket.Write(utility.BuildProxyHeaderV2(nil, nil))
+	}
+
 	// building byte array to request minecraft server info
 	// [16 0 244 5 9 49 50 55 46 48 46 48 46 49 99 211 1 1 0 ]
 	//                                          └port┘ └info┘
@@ -159,14 +170,27 @@ func getServInfo() (*model.DataInfo, *errco.MshLog) {
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sserver --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, buf[:dataLen])
 
 		recInfoData = append(recInfoData, buf[:dataLen]...)
+
+		// stop reading as soon as the full packet has been received
+		if packetLen, n := binary.Uvarint(recInfoData); n > 0 && uint64(len(recInfoData)-n) >= packetLen {
+			break
+		}
 	}
 
-	// remove first 5 bytes that are used as header to get only the json data
-	// [178 88 0 175 88]{"description":{ ...
-	if len(recInfoData) < 5 {
+	// remove header to get only the json data
+	// [ packet length | packet id (0) | json length | json ]
+	// [ 178 88        | 0             | 175 88      | {"description":{ ... ]
+	r := bytes.NewReader(recInfoData)
+	var jsonLen uint64
+	for i := 0; i < 3; i++ {
+		if jsonLen, err = binary.ReadUvarint(r); err != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, "not enough data received (%v)", recInfoData)
+		}
+	}
+	if jsonLen > uint64(r.Len()) {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, "not enough data received (%v)", recInfoData)
 	}
-	recInfoData = recInfoData[5:]
+	recInfoData = recInfoData[len(recInfoData)-r.Len():][:jsonLen]
 
 	// load data into struct
 	err = json.Unmarshal(recInfoData, recInfo)
@@ -174,20 +198,26 @@ func getServInfo() (*model.DataInfo, *errco.MshLog) {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
 	}
 
+	// store the status to be shown to clients while ms is not online
+	logMsh = s.saveStatusCache(recInfoData)
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+
 	// update server version and protocol in config
-	if recInfo.Version.Name != config.ConfigRuntime.Server.Version || recInfo.Version.Protocol != config.ConfigRuntime.Server.Protocol {
+	if recInfo.Version.Name != s.Config.Server.Version || recInfo.Version.Protocol != s.Config.Server.Protocol {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
 
 		// update runtime config if version is not specified
-		if config.ConfigRuntime.Server.Version == "" {
-			config.ConfigRuntime.Server.Version = recInfo.Version.Name
-			config.ConfigRuntime.Server.Protocol = recInfo.Version.Protocol
+		if s.Config.Server.Version == "" {
+			s.Config.Server.Version = recInfo.Version.Name
+			s.Config.Server.Protocol = recInfo.Version.Protocol
 		}
 
 		// update and save default config
-		config.ConfigDefault.Server.Version = recInfo.Version.Name
-		config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
-		logMsh := config.ConfigDefault.Save()
+		s.ConfigDefault.Server.Version = recInfo.Version.Name
+		s.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
+		logMsh := s.ConfigDefault.Save()
 		if logMsh != nil {
 			return nil, logMsh.AddTrace()
 		}
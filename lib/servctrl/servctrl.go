@@ -3,54 +3,76 @@ package servctrl
 import (
 	"time"
 
-	"msh/lib/config"
 	"msh/lib/errco"
-	"msh/lib/opsys"
-	"msh/lib/servstats"
+	"msh/lib/events"
 )
 
 // WarmMS warms the minecraft server
 // [non-blocking]
-func WarmMS() *errco.MshLog {
+func (s *Server) WarmMS() *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "issued minecraft server warm...")
 
 	// don't try to warm ms if it has encountered major errors
-	if servstats.Stats.MajorError != nil {
+	if s.Stats.MajorError != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server has encountered major problems")
 	}
 
-	switch servstats.Stats.Status {
+	// don't wake ms while its world is being backed up
+	if s.BackingUp() {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_BACKUP_RUNNING, "minecraft server can't be woken while its world is being backed up")
+	}
+
+	// don't wake ms during a hibernate window
+	if s.Stats.Status == errco.SERVER_STATUS_OFFLINE || s.Stats.Status == errco.SERVER_STATUS_SUSPENDED || s.Stats.Suspended {
+		if message, hibernating := s.ScheduleHibernation(); hibernating {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SCHEDULE, "minecraft server can't be woken: %s", message)
+		}
+	}
+
+	switch s.Stats.Status {
 
 	case errco.SERVER_STATUS_OFFLINE:
 		// ms is offline, log error if ms process is set to suspended
 
-		if servstats.Stats.Suspended {
+		if s.Stats.Suspended {
 			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE_SUSPENDED, "minecraft server is suspended and offline")
-			servstats.Stats.Suspended = false // if ms is offline it's process can't be suspended
+			s.Stats.Suspended = false // if ms is offline it's process can't be suspended
 		}
 
-		logMsh = termStart()
+		events.Publish(events.WARMING, s.Name, nil)
+
+		logMsh = s.termStart()
 		if logMsh != nil {
-			servstats.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
+			s.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
+			events.Publish(events.MAJOR_ERROR, s.Name, map[string]interface{}{"error": "error starting minecraft server (check logs)"})
 			return logMsh.AddTrace()
 		}
+		s.Stats.Wakeups++
 
 	case errco.SERVER_STATUS_SUSPENDED:
 		// Server is suspended, resume it
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if s.Config.Msh.SuspendAllow {
+			s.Stats.Suspended, logMsh = s.procResume()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
+			// load back ms memory swapped out during suspension
+			if s.Config.Msh.SuspendPrefault {
+				if logMsh := s.procPrefault(); logMsh != nil {
+					logMsh.Log(true)
+				}
+			}
 			// Update server status back to online
-			servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
+			s.Stats.Status = errco.SERVER_STATUS_ONLINE
+			s.Stats.Wakeups++
+			events.Publish(events.RESUMED, s.Name, nil)
 		}
 
 	default:
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if s.Config.Msh.SuspendAllow {
+			s.Stats.Suspended, logMsh = s.procResume()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -58,10 +80,10 @@ func WarmMS() *errco.MshLog {
 	}
 
 	// set mc warmup time
-	servstats.Stats.WarmUpTime = time.Now()
+	s.Stats.WarmUpTime = time.Now()
 
 	// schedule soft freeze of ms
-	FreezeMSSchedule()
+	s.FreezeMSSchedule()
 
 	return nil
 }
@@ -70,7 +92,7 @@ func WarmMS() *errco.MshLog {
 // When force == true, it does not perform player check and orders the server shutdown (according to ms status)
 //
 // If force freeze is issued while ms is starting, this func waits for ms to reach online state and then force freeze it.
-func FreezeMS(force bool) *errco.MshLog {
+func (s *Server) FreezeMS(force bool) *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	if force {
@@ -79,15 +101,15 @@ func FreezeMS(force bool) *errco.MshLog {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing ms soft freeze...")
 	}
 
-	switch servstats.Stats.Status {
+	switch s.Stats.Status {
 
 	case errco.SERVER_STATUS_STARTING:
 		// ms is starting, resume the ms process and freeze ms
 
 		// resume ms process (un/suspended)
 		// to be sure that ms process is running to allow ms start
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if s.Config.Msh.SuspendAllow {
+			s.Stats.Suspended, logMsh = s.procResume()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -96,12 +118,12 @@ func FreezeMS(force bool) *errco.MshLog {
 		if force {
 			// wait ms to go online
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server to go online... (msh will stop it after)")
-			for servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
+			for s.Stats.Status == errco.SERVER_STATUS_STARTING {
 				time.Sleep(1 * time.Second)
 			}
 
 			// if ms not online return error
-			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			if s.Stats.Status != errco.SERVER_STATUS_ONLINE {
 				return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server did not reach online status after starting")
 			}
 
@@ -113,7 +135,7 @@ func FreezeMS(force bool) *errco.MshLog {
 		} else {
 			// schedule soft freeze of ms
 			// (give ms more time to start)
-			FreezeMSSchedule()
+			s.FreezeMSSchedule()
 			return nil
 		}
 
@@ -125,7 +147,7 @@ func FreezeMS(force bool) *errco.MshLog {
 
 		// if force freeze, resume and stop ms
 		if force {
-			logMsh = resumeStopMS()
+			logMsh = s.resumeStopMS()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -133,21 +155,55 @@ func FreezeMS(force bool) *errco.MshLog {
 		}
 
 		// check how many players are on the server
-		if countPlayerSafe() > 0 {
+		if s.countPlayerSafe() > 0 {
 			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_EMPTY, "server is not empty")
 		}
 
+		// keep ms warm while a player postponed hibernation
+		if s.staying() {
+			s.FreezeMSSchedule()
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_STAY, "minecraft server hibernation is postponed by a player")
+		}
+
+		// keep ms warm during a warm window
+		// (soft freeze is rescheduled so that ms is frozen after the window)
+		if s.scheduleWarm() {
+			s.FreezeMSSchedule()
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SCHEDULE, "minecraft server is kept warm by schedule")
+		}
+
 		// suspend/stop ms
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeSuspend(uint32(ServTerm.cmd.Process.Pid))
+		if s.Config.Msh.SuspendAllow {
+			s.Stats.Suspended, logMsh = s.procSuspend()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
+			// swap out ms memory to reclaim ram during suspension
+			if s.Config.Msh.SuspendReclaim {
+				reclaimed, logMsh := s.procReclaim()
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+				s.Stats.ReclaimedTotal += float64(reclaimed)
+			}
 			// Update server status to suspended
-			servstats.Stats.Status = errco.SERVER_STATUS_SUSPENDED
+			s.Stats.Status = errco.SERVER_STATUS_SUSPENDED
+			s.Stats.LastOnline = time.Now()
+			events.Publish(events.SUSPENDED, s.Name, nil)
+		} else if s.Config.Msh.CheckpointAllow {
+			// checkpoint ms process to disk
+			logMsh = s.checkpointMS()
+			if logMsh != nil {
+				logMsh.Log(true)
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CHECKPOINT, "could not checkpoint minecraft server: stopping it")
+				logMsh = s.resumeStopMS()
+				if logMsh != nil {
+					return logMsh.AddTrace()
+				}
+			}
 		} else {
 			// resume and stop ms
-			logMsh = resumeStopMS()
+			logMsh = s.resumeStopMS()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -159,8 +215,8 @@ func FreezeMS(force bool) *errco.MshLog {
 		// is ms is stopping, resume the process and let it stop
 
 		// resume ms process (un/suspended)
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if s.Config.Msh.SuspendAllow {
+			s.Stats.Suspended, logMsh = s.procResume()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -169,7 +225,7 @@ func FreezeMS(force bool) *errco.MshLog {
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_STOPPING, "waiting for minecraft server to go offline...")
 
 		// wait for ms to go offline
-		for servstats.Stats.Status == errco.SERVER_STATUS_STOPPING {
+		for s.Stats.Status == errco.SERVER_STATUS_STOPPING {
 			time.Sleep(1 * time.Second)
 		}
 
@@ -179,9 +235,9 @@ func FreezeMS(force bool) *errco.MshLog {
 		// ms is offline
 
 		// log error if ms process is set to suspended
-		if servstats.Stats.Suspended {
+		if s.Stats.Suspended {
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE_SUSPENDED, "minecraft server is suspended and offline")
-			servstats.Stats.Suspended = false // if ms is offline it's process can't be suspended
+			s.Stats.Suspended = false // if ms is offline it's process can't be suspended
 		}
 
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE, "minecraft server is offline")
@@ -194,23 +250,26 @@ func FreezeMS(force bool) *errco.MshLog {
 }
 
 // FreezeMSSchedule stops freeze timer and schedules a soft freeze of ms
-func FreezeMSSchedule() {
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds", config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)
+func (s *Server) FreezeMSSchedule() {
+	delay, reason := s.freezeDelay()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds (%s)", int64(delay.Seconds()), reason)
 
 	// stop freeze timer so that it can be reset
 	// don't use drain channel procedure described in Stop() as it might happen
 	// that at this point a signal has already been received from t.C
 	// (calling a <-channel might be blocking)
-	_ = servstats.Stats.FreezeTimer.Stop()
+	_ = s.Stats.FreezeTimer.Stop()
 
-	// schedule soft freeze of ms in TimeBeforeStoppingEmptyServer seconds
+	events.Publish(events.FREEZE_SCHEDULED, s.Name, map[string]interface{}{"seconds": int64(delay.Seconds())})
+
+	// schedule soft freeze of ms after delay
 	// [goroutine]
-	servstats.Stats.FreezeTimer = time.AfterFunc(
-		time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)*time.Second,
+	s.Stats.FreezeTimer = time.AfterFunc(
+		delay,
 		func() {
 			// perform soft freeze of ms
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "performing scheduled ms soft freeze")
-			logMsh := FreezeMS(false)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "performing scheduled ms soft freeze (%s)", s.Name)
+			logMsh := s.FreezeMS(false)
 			if logMsh != nil {
 				logMsh.Log(true)
 			}
@@ -220,26 +279,30 @@ func FreezeMSSchedule() {
 
 // resumeStopMS resumes ms process and executes a stop command in ms terminal.
 //
-// Should be called only when servstats.Stats.Status == ONLINE
-func resumeStopMS() *errco.MshLog {
+// Should be called only when s.Stats.Status == ONLINE
+func (s *Server) resumeStopMS() *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	// resume ms process (un/suspended)
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+	if s.Config.Msh.SuspendAllow {
+		s.Stats.Suspended, logMsh = s.procResume()
 		if logMsh != nil {
 			return logMsh.AddTrace()
 		}
 	}
 
-	// execute stop command
-	_, logMsh = Execute(config.ConfigRuntime.Commands.StopServer)
+	// execute stop command (or stop hook of attached ms)
+	if s.Config.Commands.Attach {
+		logMsh = s.attachStop()
+	} else {
+		_, logMsh = s.Execute(s.Config.Commands.StopServer)
+	}
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
 	// launch a function to check the shutdown of minecraft server
-	go killMSifOnlineAfterTimeout()
+	go s.killMSifOnlineAfterTimeout()
 
 	return nil
 }
@@ -248,20 +311,20 @@ func resumeStopMS() *errco.MshLog {
 // if the server is still online, kills the server process.
 //
 // if StopServerAllowKill is disabled this function does nothing.
-func killMSifOnlineAfterTimeout() {
+func (s *Server) killMSifOnlineAfterTimeout() {
 	var logMsh *errco.MshLog
 
 	// if StopServerAllowKill is disabled in config, do nothing
-	if config.ConfigRuntime.Commands.StopServerAllowKill <= 0 {
+	if s.Config.Commands.StopServerAllowKill <= 0 {
 		return
 	}
 
-	countdown := config.ConfigRuntime.Commands.StopServerAllowKill
+	countdown := s.Config.Commands.StopServerAllowKill
 
 	// resume ms process (un/suspended)
 	// to be sure that ms is running to stop itself
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+	if s.Config.Msh.SuspendAllow {
+		s.Stats.Suspended, logMsh = s.procResume()
 		if logMsh != nil {
 			logMsh.Log(true)
 		}
@@ -269,7 +332,7 @@ func killMSifOnlineAfterTimeout() {
 
 	for countdown > 0 {
 		// if server goes offline it's the correct behaviour -> return
-		if servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE {
+		if s.Stats.Status == errco.SERVER_STATUS_OFFLINE {
 			return
 		}
 
@@ -279,15 +342,20 @@ func killMSifOnlineAfterTimeout() {
 
 	// save world before killing the server, do not check for errors
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saving word before killing the minecraft server process")
-	_, _ = Execute("save-all")
+	_, _ = s.Execute("save-all")
 
 	// give time to save word
 	time.Sleep(10 * time.Second)
 
 	// send kill signal to server
 	errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_KILL, "minecraft server process won't stop normally: sending kill signal")
-	LogMsh := opsys.ProcTreeKill(uint32(ServTerm.cmd.Process.Pid))
+	LogMsh := s.procKill()
 	if LogMsh != nil {
 		LogMsh.Log(true)
+		return
 	}
+	s.Stats.M.Lock()
+	s.Stats.Kills++
+	s.Stats.M.Unlock()
+	events.Publish(events.KILLED, s.Name, nil)
 }
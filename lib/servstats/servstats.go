@@ -7,21 +7,10 @@ import (
 	"msh/lib/errco"
 )
 
-// Stats contains the info relative to server
-var Stats *serverStats = &serverStats{
-	M:              &sync.Mutex{},
-	Status:         errco.SERVER_STATUS_OFFLINE,
-	Suspended:      false,
-	MajorError:     nil,
-	ConnCount:      0,
-	FreezeTimer:    time.NewTimer(5 * time.Minute),
-	WarmUpTime:     time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
-	LoadProgress:   "0%",
-	BytesToClients: 0,
-	BytesToServer:  0,
-}
+// Stats contains the info relative to the default minecraft server
+var Stats *ServerStats = NewStats()
 
-type serverStats struct {
+type ServerStats struct {
 	M              *sync.Mutex
 	Status         int           // represent the status of the minecraft server
 	Suspended      bool          // status of minecraft server process (if ms is offline, should be set to false)
@@ -29,14 +18,64 @@ type serverStats struct {
 	ConnCount      int           // tracks active client connections to ms (only clients that are playing on ms)
 	FreezeTimer    *time.Timer   // timer to freeze minecraft server
 	WarmUpTime     time.Time     // time at which minecraft server was warmed up
+	LastOnline     time.Time     // time at which minecraft server was last online (zero if never)
 	LoadProgress   string        // tracks loading percentage of starting server
+	BootEstimate   time.Duration // estimated boot duration learned from previous boots (0 if unknown)
 	BytesToClients float64       // tracks bytes/s server->clients
 	BytesToServer  float64       // tracks bytes/s clients->server
+	StatusCache    []byte        // last status json received from minecraft server (nil if not available)
+
+	// counters since msh start (exported as metrics)
+	Wakeups             int                // times ms was started or resumed
+	Kills               int                // times ms process was killed because it did not stop
+	Crashes             int                // times ms crashed
+	ReclaimedTotal      float64            // bytes of suspended ms memory swapped out
+	MajorErrors         int                // major errors encountered by ms
+	BytesToClientsTotal float64            // bytes sent to clients
+	BytesToServerTotal  float64            // bytes sent to ms
+	BootDurations       []float64          // seconds needed by ms to be online, for each boot
+	StatusSeconds       map[string]float64 // seconds spent by ms in each status
+}
+
+// NewStats returns the stats of a minecraft server that has not been started yet
+func NewStats() *ServerStats {
+	return &ServerStats{
+		M:              &sync.Mutex{},
+		Status:         errco.SERVER_STATUS_OFFLINE,
+		Suspended:      false,
+		MajorError:     nil,
+		ConnCount:      0,
+		FreezeTimer:    time.NewTimer(5 * time.Minute),
+		WarmUpTime:     time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
+		LoadProgress:   "0%",
+		BytesToClients: 0,
+		BytesToServer:  0,
+		StatusSeconds:  map[string]float64{},
+	}
 }
 
-// SetMajorError sets *serverStats.MajorError only if nil
-func (s *serverStats) SetMajorError(e *errco.MshLog) {
+// SetMajorError sets *ServerStats.MajorError only if nil
+func (s *ServerStats) SetMajorError(e *errco.MshLog) {
 	if s.MajorError == nil {
 		s.MajorError = e
+		s.MajorErrors++
+	}
+}
+
+// StatusName returns the minecraft server status as lowercase string (offline, starting, online, stopping, suspended)
+func (s *ServerStats) StatusName() string {
+	switch {
+	case s.Status == errco.SERVER_STATUS_SUSPENDED || (s.Status == errco.SERVER_STATUS_ONLINE && s.Suspended):
+		return "suspended"
+	case s.Status == errco.SERVER_STATUS_OFFLINE:
+		return "offline"
+	case s.Status == errco.SERVER_STATUS_STARTING:
+		return "starting"
+	case s.Status == errco.SERVER_STATUS_ONLINE:
+		return "online"
+	case s.Status == errco.SERVER_STATUS_STOPPING:
+		return "stopping"
+	default:
+		return "unknown"
 	}
 }
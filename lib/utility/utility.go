@@ -2,6 +2,7 @@ package utility
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"math"
@@ -122,6 +123,29 @@ func RoundSec(t time.Duration) int {
 	return int(math.Round(float64(t.Milliseconds() / 1000)))
 }
 
+// HumanDuration returns a short human readable representation of a time duration
+// (examples: "45s", "3m", "2h5m", "3d4h")
+func HumanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		if m := int(d.Minutes()) % 60; m != 0 {
+			return fmt.Sprintf("%dh%dm", int(d.Hours()), m)
+		}
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		if h := int(d.Hours()) % 24; h != 0 {
+			return fmt.Sprintf("%dd%dh", int(d.Hours())/24, h)
+		}
+		return fmt.Sprintf("%dd", int(d.Hours())/24)
+	}
+}
+
 // ScaleImg scales the image to rectangle size
 func ScaleImg(srcImg image.Image, rect image.Rectangle) (image.Image, time.Duration) {
 	i := time.Now()
@@ -181,3 +205,40 @@ func GetOutboundIP4() string {
 
 	return conn.LocalAddr().(*net.UDPAddr).IP.To4().String()
 }
+
+// ProxyProtSigV2 is the signature that starts a PROXY protocol v2 header
+// (reference: haproxy.org/download/2.8/doc/proxy-protocol.txt)
+var ProxyProtSigV2 []byte = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// BuildProxyHeaderV2 returns the PROXY protocol v2 header to be sent to the minecraft server
+// for a connection from src to dst.
+func BuildProxyHeaderV2(src, dst net.Addr) []byte {
+	header := bytes.NewBuffer(append([]byte{}, ProxyProtSigV2...))
+
+	srcTCP, okSrc := src.(*net.TCPAddr)
+	dstTCP, okDst := dst.(*net.TCPAddr)
+
+	switch {
+	case !okSrc || !okDst:
+		// LOCAL command, no addresses
+		header.Write([]byte{0x20, 0x00, 0, 0})
+
+	case srcTCP.IP.To4() != nil && dstTCP.IP.To4() != nil:
+		// PROXY command, TCP over IPv4
+		header.Write([]byte{0x21, 0x11, 0, 12})
+		header.Write(srcTCP.IP.To4())
+		header.Write(dstTCP.IP.To4())
+		binary.Write(header, binary.BigEndian, uint16(srcTCP.Port))
+		binary.Write(header, binary.BigEndian, uint16(dstTCP.Port))
+
+	default:
+		// PROXY command, TCP over IPv6
+		header.Write([]byte{0x21, 0x21, 0, 36})
+		header.Write(srcTCP.IP.To16())
+		header.Write(dstTCP.IP.To16())
+		binary.Write(header, binary.BigEndian, uint16(srcTCP.Port))
+		binary.Write(header, binary.BigEndian, uint16(dstTCP.Port))
+	}
+
+	return header.Bytes()
+}
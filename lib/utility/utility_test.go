@@ -3,6 +3,7 @@ package utility
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func Test_FirstNon(t *testing.T) {
@@ -29,3 +30,22 @@ func Test_FirstNon(t *testing.T) {
 		fmt.Println(fn)
 	}
 }
+
+func Test_HumanDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                            "0s",
+		45 * time.Second:             "45s",
+		90 * time.Second:             "1m",
+		2 * time.Hour:                "2h",
+		2*time.Hour + 5*time.Minute:  "2h5m",
+		3 * 24 * time.Hour:           "3d",
+		3*24*time.Hour + 4*time.Hour: "3d4h",
+		1500 * time.Millisecond:      "2s",
+	}
+
+	for d, expected := range tests {
+		if hd := HumanDuration(d); hd != expected {
+			t.Errorf("HumanDuration(%s) = %s (expected %s)", d, hd, expected)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/events"
+	"msh/lib/model"
+)
+
+var (
+	// retryDelay is the delay before the first retry (doubled at each retry)
+	retryDelay time.Duration = 2 * time.Second
+
+	// client is the http client used to send webhook requests
+	client *http.Client = &http.Client{Timeout: 10 * time.Second}
+)
+
+// HandlerWebhooks sends the msh events to the webhooks specified in config.
+// [goroutine]
+func HandlerWebhooks() {
+	c, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %16d ...", "sending events to webhooks", len(config.ConfigRuntime.Webhooks))
+
+	for e := range c {
+		for _, wh := range config.ConfigRuntime.Webhooks {
+			payload, ok := buildPayload(wh, e)
+			if !ok {
+				continue
+			}
+
+			go func(wh model.Webhook, e events.Event) {
+				logMsh := send(wh, e.Type, payload)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+			}(wh, e)
+		}
+	}
+}
+
+// buildPayload returns the payload to be sent to the webhook for the event.
+// Returns false if the webhook is not interested in the event.
+//
+// The template placeholders {type}, {server}, {time} and the event data keys (like {player}, {address})
+// are replaced with the json escaped event values.
+// If the template is empty the event is sent as json.
+func buildPayload(wh model.Webhook, e events.Event) ([]byte, bool) {
+	template, ok := wh.Events[e.Type]
+	if !ok {
+		if template, ok = wh.Events["*"]; !ok {
+			return nil, false
+		}
+	}
+
+	if template == "" {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+			return nil, false
+		}
+		return payload, true
+	}
+
+	placeholders := map[string]interface{}{
+		"type":   e.Type,
+		"server": e.Server,
+		"time":   e.Time.Format(time.RFC3339),
+	}
+	for k, v := range e.Data {
+		placeholders[k] = v
+	}
+
+	for k, v := range placeholders {
+		escaped, _ := json.Marshal(fmt.Sprint(v))
+		template = strings.ReplaceAll(template, "{"+k+"}", string(escaped[1:len(escaped)-1]))
+	}
+
+	if !json.Valid([]byte(template)) {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WEBHOOK_TEMPLATE, "webhook template for event %s is not valid json: %s", e.Type, template)
+		return nil, false
+	}
+
+	return []byte(template), true
+}
+
+// send posts the payload to the webhook url.
+// Failed deliveries (connection errors, 429 and 5xx responses) are retried with exponential backoff.
+func send(wh model.Webhook, eventType string, payload []byte) *errco.MshLog {
+	delay := retryDelay
+
+	for attempt := 0; ; attempt++ {
+		retry, logMsh := post(wh, eventType, payload)
+		if logMsh == nil {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "webhook %s sent to %s", eventType, wh.URL)
+			return nil
+		}
+		if !retry || attempt >= wh.Retries {
+			return logMsh.AddTrace()
+		}
+
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "retrying webhook %s in %s (attempt %d of %d)", eventType, delay.String(), attempt+1, wh.Retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends a single webhook request.
+// Returns true if the request can be retried.
+func post(wh model.Webhook, eventType string, payload []byte) (bool, *errco.MshLog) {
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_WEBHOOK_SEND, err.Error())
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "msh-webhook")
+	req.Header.Set("X-Msh-Event", eventType)
+	if wh.Secret != "" {
+		req.Header.Set("X-Msh-Signature", "sha256="+sign(wh.Secret, payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WEBHOOK_SEND, err.Error())
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WEBHOOK_SEND, "webhook %s response: %s", wh.URL, resp.Status)
+	default:
+		return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WEBHOOK_SEND, "webhook %s response: %s", wh.URL, resp.Status)
+	}
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the payload
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"msh/lib/events"
+	"msh/lib/model"
+)
+
+func Test_buildPayload(t *testing.T) {
+	e := events.Event{
+		Type:   events.WAKE,
+		Server: "survival",
+		Time:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:   map[string]interface{}{"player": `Steve "the" player`, "address": "1.2.3.4"},
+	}
+
+	wh := model.Webhook{Events: map[string]string{
+		events.WAKE: `{"content": "{player} ({address}) woke {server} at {time}"}`,
+	}}
+	payload, ok := buildPayload(wh, e)
+	if !ok {
+		t.Fatalf("payload not built")
+	}
+	var p struct{ Content string }
+	if err := json.Unmarshal(payload, &p); err != nil {
+		t.Fatalf("payload is not valid json: %s", payload)
+	}
+	if p.Content != `Steve "the" player (1.2.3.4) woke survival at 2024-01-02T03:04:05Z` {
+		t.Fatalf("unexpected content: %s", p.Content)
+	}
+
+	// event not handled by the webhook
+	e.Type = events.ONLINE
+	if _, ok := buildPayload(wh, e); ok {
+		t.Fatalf("payload built for event not in webhook events")
+	}
+
+	// default payload for all events
+	wh.Events = map[string]string{"*": ""}
+	payload, ok = buildPayload(wh, e)
+	if !ok {
+		t.Fatalf("default payload not built")
+	}
+	var got events.Event
+	if err := json.Unmarshal(payload, &got); err != nil || got.Type != events.ONLINE || got.Server != "survival" {
+		t.Fatalf("unexpected default payload: %s", payload)
+	}
+
+	// template producing invalid json
+	wh.Events = map[string]string{events.ONLINE: `{"content": {server}}`}
+	if _, ok := buildPayload(wh, e); ok {
+		t.Fatalf("invalid json payload built")
+	}
+}
+
+func Test_send(t *testing.T) {
+	retryDelay = 10 * time.Millisecond
+
+	var m sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		requests++
+
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Msh-Event") != events.ONLINE {
+			t.Errorf("unexpected event header: %s", r.Header.Get("X-Msh-Event"))
+		}
+		if r.Header.Get("X-Msh-Signature") != "sha256="+sign("secret", body) {
+			t.Errorf("unexpected signature: %s", r.Header.Get("X-Msh-Signature"))
+		}
+
+		// fail the first request
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	wh := model.Webhook{URL: server.URL, Secret: "secret", Retries: 2}
+	if logMsh := send(wh, events.ONLINE, []byte(`{"content": "online"}`)); logMsh != nil {
+		t.Fatalf("webhook not sent: %s", logMsh.Mex)
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+
+	// client errors are not retried
+	requests = 0
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		requests++
+		m.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+
+	wh.URL = badRequest.URL
+	if logMsh := send(wh, events.ONLINE, []byte(`{}`)); logMsh == nil {
+		t.Fatalf("expected error for bad request response")
+	}
+	if requests != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+}
+
+// signature is verified with the RFC 4231 hmac-sha256 test case 2
+func Test_sign(t *testing.T) {
+	got := sign("Jefe", []byte("what do ya want for nothing?"))
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Fatalf("sign() = %s, want %s", got, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 
+	"msh/lib/api"
 	"msh/lib/config"
 	"msh/lib/conn"
 	"msh/lib/errco"
@@ -11,6 +12,7 @@ import (
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
 	"msh/lib/utility"
+	"msh/lib/webhook"
 )
 
 // contains intro to script and program
@@ -44,17 +46,22 @@ func main() {
 		progmgr.AutoTerminate()
 	}
 
+	// load minecraft servers specified in config routes
+	servctrl.LoadServers()
+
 	// launch msh manager
 	go progmgr.MshMgr()
 	// wait for the initial update check
 	<-progmgr.ReqSent
 
-	// if ms suspension is allowed, pre-warm the server
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server will now pre-warm (SuspendAllow is enabled)...")
-		logMsh = servctrl.WarmMS()
-		if logMsh != nil {
-			logMsh.Log(true)
+	// if ms suspension is allowed, pre-warm the servers
+	for _, srv := range servctrl.Servers() {
+		if srv.Config.Msh.SuspendAllow {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server %s will now pre-warm (SuspendAllow is enabled)...", srv.Name)
+			logMsh = srv.WarmMS()
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
 		}
 	}
 
@@ -63,6 +70,16 @@ func main() {
 
 	// ---------------- connections ---------------- //
 
+	// launch http api handler
+	if config.ConfigRuntime.Msh.ApiAddress != "" {
+		go api.HandlerAPI()
+	}
+
+	// launch webhooks handler
+	if len(config.ConfigRuntime.Webhooks) > 0 {
+		go webhook.HandlerWebhooks()
+	}
+
 	// launch query handler
 	if config.ConfigRuntime.Msh.EnableQuery {
 		go conn.HandlerQuery()